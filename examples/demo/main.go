@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"time"
 
@@ -27,7 +28,11 @@ func main() {
 
 	// Put a key-value pair in the database.
 	err = f.ReadWrite(func(r *jiffy.Reader, w *jiffy.Writer) error {
-		w.In(userGroupID).Put(key1, value1)
+		users, err := w.Group(userGroupID)
+		if err != nil {
+			return err
+		}
+		users.Put(key1, value1)
 		return nil
 	})
 	if err != nil {
@@ -36,7 +41,11 @@ func main() {
 
 	// Delete a key-value pair from the database.
 	err = f.ReadWrite(func(r *jiffy.Reader, w *jiffy.Writer) error {
-		w.In(userGroupID).Delete([]byte("006"))
+		users, err := w.Group(userGroupID)
+		if err != nil {
+			return err
+		}
+		users.Delete([]byte("006"))
 		return nil
 	})
 	if err != nil {
@@ -44,22 +53,37 @@ func main() {
 	}
 
 	// Get a key-value pair
-	f.Read(func(r *jiffy.Reader) error {
-		c := r.In(userGroupID).Seek(key1)
-		if c == nil {
-			log.Println("key not found")
-		}
-		v, err := c.History().Value()
+	err = f.Read(func(r *jiffy.Reader) error {
+		users, err := r.Group(userGroupID)
 		if err != nil {
+			return err
+		}
+		v, err := users.Get(key1)
+		if errors.Is(err, jiffy.ErrKeyNotFound) {
+			log.Println("key not found")
+			return nil
+		} else if err != nil {
 			panic(err)
 		}
 		log.Println(v)
 		return nil
 	})
+	if err != nil {
+		panic(err)
+	}
 
 	// Iterate over a given key's history of values
-	f.Read(func(r *jiffy.Reader) error {
-		history := r.In(userGroupID).Seek(key1).History()
+	err = f.Read(func(r *jiffy.Reader) error {
+		users, err := r.Group(userGroupID)
+		if err != nil {
+			return err
+		}
+		c := users.Seek(key1)
+		if c == nil {
+			log.Println("key not found")
+			return nil
+		}
+		history := c.History()
 		for i := 0; i < history.Length(); i++ {
 			version := history.Version(i)
 			v, err := version.Value()
@@ -70,25 +94,45 @@ func main() {
 		}
 		return nil
 	})
+	if err != nil {
+		panic(err)
+	}
 
 	// Check if a key-value pair exists
-	f.Read(func(r *jiffy.Reader) error {
-		if r.In(userGroupID).Seek(key1) != nil {
+	err = f.Read(func(r *jiffy.Reader) error {
+		users, err := r.Group(userGroupID)
+		if err != nil {
+			return err
+		}
+		if users.Seek(key1) != nil {
 			log.Println("already exists")
 		}
 		return nil
 	})
+	if err != nil {
+		panic(err)
+	}
 
 	// Count unique non-delete keys
-	f.Read(func(r *jiffy.Reader) error {
-		count := r.In(userGroupID).Count()
+	err = f.Read(func(r *jiffy.Reader) error {
+		users, err := r.Group(userGroupID)
+		if err != nil {
+			return err
+		}
+		count := users.Count()
 		log.Println(count)
 		return nil
 	})
+	if err != nil {
+		panic(err)
+	}
 
 	// Iterate over keys in order
-	f.Read(func(r *jiffy.Reader) error {
-		fromUsers := r.In(userGroupID)
+	err = f.Read(func(r *jiffy.Reader) error {
+		fromUsers, err := r.Group(userGroupID)
+		if err != nil {
+			return err
+		}
 
 		// Iterate over keys in chronological order
 		for c := fromUsers.Oldest(); c != nil; c = c.Next() {
@@ -106,6 +150,9 @@ func main() {
 		}
 		return nil
 	})
+	if err != nil {
+		panic(err)
+	}
 
 }
 
@@ -2,52 +2,158 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/ejuju/jiffy/pkg/jiffy"
 )
 
-func main() {
-	panic("todo: implement TCP server")
+const usage = `usage:
+  jiffy <path> [repl]         open the database and start the REPL
+  jiffy <path> leader <addr>  serve replication on the given address and start the REPL
+  jiffy <path> follow <addr>  replicate the leader at the given address and start a read-only REPL
+  jiffy <path> restore <dst> <time>
+                              write the state of the database as of the given RFC3339 time to dst
+  jiffy <path> convert <dst> <format>
+                              rewrite the database to dst using another format (ex: "binary", "binary v2", "text escaped", "jsonl")`
 
+func main() {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
 
 	if len(os.Args) <= 1 {
 		fmt.Println("missing database file path")
+		fmt.Println(usage)
 		return
 	}
 
 	start := time.Now()
 	path := os.Args[1]
-	// mode := os.Args[2] // 'server' or 'repl'
+	mode, modeArgs := "repl", []string(nil)
+	if len(os.Args) > 2 {
+		mode, modeArgs = os.Args[2], os.Args[3:]
+	}
+	switch mode {
+	default:
+		fmt.Printf("unknown mode %q\n%s\n", mode, usage)
+		return
+	case "repl":
+	case "leader", "follow":
+		if len(modeArgs) != 1 {
+			fmt.Printf("%q needs an address\n%s\n", mode, usage)
+			return
+		}
+	case "restore":
+		if len(modeArgs) != 2 {
+			fmt.Printf("%q needs a destination path and a time\n%s\n", mode, usage)
+			return
+		}
+		t, err := time.Parse(time.RFC3339, modeArgs[1])
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		err = jiffy.RestoreAsOf(path, modeArgs[0], nil, t)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		fmt.Printf("Restored %q as of %s to %q in %s\n", path, t.Format(time.RFC3339), modeArgs[0], time.Since(start))
+		return
+	case "convert":
+		if len(modeArgs) < 2 {
+			fmt.Printf("%q needs a destination path and a format\n%s\n", mode, usage)
+			return
+		}
+		dstFmt, err := jiffy.ParseFileFormat(strings.Join(modeArgs[1:], " "))
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		err = jiffy.Convert(path, nil, modeArgs[0], dstFmt)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		fmt.Printf("Converted %q to %q in %s\n", path, modeArgs[0], time.Since(start))
+		return
+	}
 
 	f, err := jiffy.Open(path, nil, map[jiffy.GroupID]int{0: 0})
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	switch mode {
+	case "leader":
+		ln, err := net.Listen("tcp", modeArgs[0])
+		if err != nil {
+			log.Println(err)
+			_ = f.Close()
+			return
+		}
+		defer ln.Close()
+		go func() {
+			err := f.ServeReplication(ln)
+			if err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Println(err)
+			}
+		}()
+		fmt.Printf("Serving replication on %s\n", ln.Addr())
+	case "follow":
+		go func() {
+			err := f.Follow(ctx, modeArgs[0])
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Println(err)
+			}
+		}()
+		fmt.Printf("Following %s\n", modeArgs[0])
+	}
 
 	fmt.Printf("Loaded %q in %s\nType a command and press enter: ", path, time.Since(start))
 
+	// Commands run on this goroutine, which also handles interrupts, so the REPL's transaction is never shared.
+	lines := make(chan string)
 	go func() {
 		bufs := bufio.NewScanner(os.Stdin)
 		for bufs.Scan() {
-			handleCommand(f, bufs.Text())
-			fmt.Print("\n? ")
+			lines <- bufs.Text()
 		}
 		if err := bufs.Err(); err != nil {
 			panic(err)
 		}
+		close(lines)
 	}()
 
-	<-interrupt
+repl:
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				lines = nil // stdin closed, wait for an interrupt
+				continue
+			}
+			handleCommand(f, line)
+			fmt.Print("\n? ")
+		case <-interrupt:
+			break repl
+		}
+	}
+	cancel() // stop following
+	if tx != nil {
+		_ = tx.Rollback() // release the write lock held by an unfinished "begin" block, Close waits for it otherwise
+	}
 	err = f.Close()
 	if err != nil {
 		log.Println(err)
@@ -0,0 +1,105 @@
+package jiffy
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Backup writes a consistent copy of the file to w while transactions keep being committed.
+// Since the file is append-only, the copy ends at the last committed offset when the backup started.
+// The returned offset can be passed to BackupSince for subsequent incremental backups.
+func (f *File) Backup(w io.Writer) (int64, error) { return f.BackupSince(w, 0) }
+
+// BackupSince writes the bytes committed after the given offset (as returned by a previous backup).
+// Appending them to the previous backup results in a consistent copy of the file.
+func (f *File) BackupSince(w io.Writer, offset int64) (int64, error) {
+	f.mu.RLock()
+	size, err := f.fsize, f.checkOpen()
+	f.mu.RUnlock()
+	if err != nil {
+		return offset, err
+	}
+	if offset < 0 || offset > size {
+		return offset, fmt.Errorf("backup offset %d is out of range (file size is %d)", offset, size)
+	}
+	_, err = io.Copy(w, io.NewSectionReader(f.r, offset, size-offset))
+	if err != nil {
+		return offset, fmt.Errorf("copy from offset %d: %w", offset, wrapClosed(err))
+	}
+	return size, nil
+}
+
+// BackupTo writes a full backup to the given path, replacing any existing file once the copy is complete.
+func (f *File) BackupTo(fpath string) (int64, error) {
+	tmpPath := fpath + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return 0, fmt.Errorf("create temporary backup file: %w", err)
+	}
+	defer os.Remove(tmpPath) // no-op once renamed
+	offset, err := f.Backup(dst)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return offset, err
+	}
+	err = os.Rename(tmpPath, fpath)
+	if err != nil {
+		return offset, fmt.Errorf("rename temporary backup file: %w", err)
+	}
+	return offset, nil
+}
+
+// IncrementalBackupTo appends the bytes committed since the previous backup at the given path.
+// The existing backup must be a prefix of the file, otherwise an error is returned.
+// If there is no file at the given path, a full backup is written.
+func (f *File) IncrementalBackupTo(fpath string) (int64, error) {
+	dst, err := os.OpenFile(fpath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return 0, fmt.Errorf("open backup file: %w", err)
+	}
+	defer dst.Close()
+
+	// Check that the previous backup matches the file
+	stat, err := dst.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat backup file: %w", err)
+	}
+	offset := stat.Size()
+	f.mu.RLock()
+	size, err := f.fsize, f.checkOpen()
+	f.mu.RUnlock()
+	if err != nil {
+		return offset, err
+	}
+	if offset > size {
+		return offset, fmt.Errorf("backup (%d B) is larger than file (%d B)", offset, size)
+	}
+	backupChecksum, err := tailChecksum(dst, offset)
+	if err != nil {
+		return offset, err
+	}
+	checksum, err := tailChecksum(f.r, offset)
+	if err != nil {
+		return offset, err
+	}
+	if backupChecksum != checksum {
+		return offset, fmt.Errorf("backup is not a prefix of %q", f.fpath)
+	}
+
+	// Append new bytes
+	offset, err = f.BackupSince(dst, offset)
+	if err != nil {
+		return offset, err
+	}
+	err = dst.Sync()
+	if err != nil {
+		return offset, fmt.Errorf("sync backup file: %w", err)
+	}
+	return offset, nil
+}
@@ -0,0 +1,92 @@
+package jiffy
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupTo(t *testing.T) {
+	dir := t.TempDir()
+	f := openTestFile(t, filepath.Join(dir, "db"))
+	putTestValues(t, f, "a", "1")
+	backup := filepath.Join(dir, "backup")
+	offset, err := f.BackupTo(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != f.fsize {
+		t.Fatalf("got offset %d, want %d", offset, f.fsize)
+	}
+	putTestValues(t, f, "b", "2") // not in the backup
+	assertTestValues(t, openTestFile(t, backup), map[string]string{"a": "1"})
+}
+
+func TestIncrementalBackupTo(t *testing.T) {
+	dir := t.TempDir()
+	fpath, backup := filepath.Join(dir, "db"), filepath.Join(dir, "backup")
+	f := openTestFile(t, fpath)
+	putTestValues(t, f, "a", "1")
+	_, err := f.IncrementalBackupTo(backup) // full backup
+	if err != nil {
+		t.Fatal(err)
+	}
+	putTestValues(t, f, "b", "2")
+	offset, err := f.IncrementalBackupTo(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != f.fsize {
+		t.Fatalf("got offset %d, want %d", offset, f.fsize)
+	}
+	assertSameTestFiles(t, fpath, backup)
+
+	// The backup must be a prefix of the file
+	content, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[len(content)-2] ^= 0xff
+	err = os.WriteFile(backup, content, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.IncrementalBackupTo(backup)
+	if err == nil {
+		t.Fatal("got no error appending to a backup that isn't a prefix of the file")
+	}
+	err = os.WriteFile(backup, append(content, '\n'), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.IncrementalBackupTo(backup)
+	if err == nil {
+		t.Fatal("got no error appending to a backup larger than the file")
+	}
+}
+
+func TestBackupSinceOutOfRange(t *testing.T) {
+	f := openTestFile(t, filepath.Join(t.TempDir(), "db"))
+	for _, offset := range []int64{-1, f.fsize + 1} {
+		_, err := f.BackupSince(&bytes.Buffer{}, offset)
+		if err == nil {
+			t.Fatalf("got no error for offset %d (file size is %d)", offset, f.fsize)
+		}
+	}
+}
+
+func assertSameTestFiles(t *testing.T, a, b string) {
+	t.Helper()
+	aBytes, err := os.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bBytes, err := os.ReadFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(aBytes, bBytes) {
+		t.Fatalf("%q differs from %q:\n%q\n%q", b, a, bBytes, aBytes)
+	}
+}
@@ -0,0 +1,115 @@
+package jiffy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// BinaryFileFormatV2 is a compact binary format using variable-length integers:
+//
+//	op + group + timestamp (varint) + klen (uvarint) + vlen (uvarint) + key + value
+//
+// Commit lines store their timestamp as Unix nanoseconds.
+// Other lines store the nanoseconds elapsed before their transaction's commit (see Line.BeforeCommit),
+// their timestamp is resolved once the commit line is read.
+// Keys are limited to MaxLongKeyLength instead of MaxKeyLength.
+type BinaryFileFormatV2 struct{}
+
+func (BinaryFileFormatV2) Descriptor() string { return "binary v2" }
+
+func (BinaryFileFormatV2) Encode(l Line) ([]byte, error) {
+	err := validateLengths(l.Key, l.Value, MaxLongKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 0, 2+3*binary.MaxVarintLen64+len(l.Key)+len(l.Value))
+	b = append(b, byte(l.Op), byte(l.GroupID)) // + op + GID
+	if l.Op == OpCommit {
+		b = binary.AppendVarint(b, l.At.UnixNano()) // + timestamp
+	} else {
+		b = binary.AppendUvarint(b, uint64(max(l.BeforeCommit, 0))) // + time before commit
+	}
+	b = binary.AppendUvarint(b, uint64(len(l.Key)))     // + klen
+	b = binary.AppendUvarint(b, uint64(len(l.Value)))   // + vlen
+	return append(append(b, l.Key...), l.Value...), nil // + key + value
+}
+
+func (BinaryFileFormatV2) Decode(r *bufio.Reader) (int64, Line, error) {
+	cr := &countingByteReader{r: r}
+	l := Line{}
+
+	// Read header
+	op, err := cr.ReadByte()
+	if err != nil {
+		return cr.n, l, fmt.Errorf("read op: %w", err)
+	}
+	gid, err := cr.ReadByte()
+	if err != nil {
+		return cr.n, l, fmt.Errorf("read group ID: %w", eofIsUnexpected(err))
+	}
+	l.Op, l.GroupID = Opcode(op), GroupID(gid)
+	if l.Op == OpCommit {
+		at, err := binary.ReadVarint(cr)
+		if err != nil {
+			return cr.n, l, fmt.Errorf("read timestamp: %w", eofIsUnexpected(err))
+		}
+		l.At = time.Unix(0, at)
+	} else {
+		beforeCommit, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return cr.n, l, fmt.Errorf("read time before commit: %w", eofIsUnexpected(err))
+		}
+		l.BeforeCommit = time.Duration(beforeCommit)
+	}
+	klen, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return cr.n, l, fmt.Errorf("read key length: %w", eofIsUnexpected(err))
+	}
+	vlen, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return cr.n, l, fmt.Errorf("read value length: %w", eofIsUnexpected(err))
+	}
+	if klen > MaxLongKeyLength || vlen > MaxValueLength {
+		return cr.n, l, fmt.Errorf("invalid slot lengths (key: %d B, value: %d B)", klen, vlen)
+	}
+
+	// Read slots
+	slots := make([]byte, klen+vlen)
+	n, err := io.ReadFull(r, slots)
+	cr.n += int64(n)
+	if err != nil {
+		return cr.n, l, fmt.Errorf("read slots: %w", err)
+	}
+	if klen > 0 {
+		l.Key = slots[:klen]
+	}
+	if vlen > 0 {
+		l.Value = slots[klen:]
+	}
+	return cr.n, l, nil
+}
+
+// countingByteReader counts the bytes read from the underlying reader.
+type countingByteReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (cr *countingByteReader) ReadByte() (byte, error) {
+	c, err := cr.r.ReadByte()
+	if err == nil {
+		cr.n++
+	}
+	return c, err
+}
+
+// eofIsUnexpected reports io.EOF as io.ErrUnexpectedEOF for reads in the middle of a line.
+func eofIsUnexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package jiffy
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+)
+
+// ValueCache keeps recently read and written values in memory, so Version.Value doesn't read the file again.
+// The total length of cached values is bounded by maxBytes, the least recently used values are evicted first.
+// Empty values are not cached, and the cache is disabled if maxBytes is zero or negative.
+func ValueCache(maxBytes int) Option {
+	return func(f *File) {
+		f.cache = nil
+		if maxBytes > 0 {
+			f.cache = newValueCache(maxBytes)
+		}
+	}
+}
+
+// CacheStats reports the activity of the value cache (see ValueCache).
+type CacheStats struct {
+	Hits, Misses uint64
+	Entries      int // number of cached values
+	Bytes        int // total length of cached values
+}
+
+// CacheStats returns the value cache statistics (zero if the file was opened without ValueCache).
+func (f *File) CacheStats() CacheStats { return f.cache.stats() }
+
+// valueCache is a size-bounded LRU cache of decoded values, keyed by line position.
+// Lines are never rewritten, so cached values never go stale.
+// It has its own lock since values are read concurrently by read-only transactions.
+type valueCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	bytes    int
+	lru      *list.List // most recently used first
+	items    map[Position]*list.Element
+	hits     uint64
+	misses   uint64
+}
+
+type valueCacheEntry struct {
+	p     Position
+	value []byte
+}
+
+func newValueCache(maxBytes int) *valueCache {
+	return &valueCache{maxBytes: maxBytes, lru: list.New(), items: map[Position]*list.Element{}}
+}
+
+// get returns a copy of the cached value, a nil cache always misses.
+func (c *valueCache) get(p Position) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[p]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(elem)
+	return bytes.Clone(elem.Value.(*valueCacheEntry).value), true
+}
+
+// add caches a copy of the value and evicts the least recently used values if needed.
+// Empty values are skipped since they don't count towards maxBytes and would never be evicted.
+func (c *valueCache) add(p Position, value []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(value) == 0 || len(value) > c.maxBytes {
+		return
+	}
+	if elem, ok := c.items[p]; ok {
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.items[p] = c.lru.PushFront(&valueCacheEntry{p: p, value: bytes.Clone(value)})
+	c.bytes += len(value)
+	for c.bytes > c.maxBytes {
+		entry := c.lru.Remove(c.lru.Back()).(*valueCacheEntry)
+		delete(c.items, entry.p)
+		c.bytes -= len(entry.value)
+	}
+}
+
+// close drops the cached values and disables the cache, so that reading values of a closed file returns ErrClosed.
+func (c *valueCache) close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxBytes, c.bytes = 0, 0
+	c.lru.Init()
+	clear(c.items)
+}
+
+func (c *valueCache) stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.lru.Len(), Bytes: c.bytes}
+}
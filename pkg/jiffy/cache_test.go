@@ -0,0 +1,71 @@
+package jiffy
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestValueCacheEviction(t *testing.T) {
+	f := openTestFile(t, filepath.Join(t.TempDir(), "db"), ValueCache(10))
+	putTestValues(t, f, "a", "12345", "b", "12345") // cached on commit
+	readTestValue(t, f, "a")                        // hit, b is now the least recently used value
+	putTestValues(t, f, "c", "12345")               // evicts b
+	readTestValue(t, f, "b")                        // miss, evicts a
+	readTestValue(t, f, "c")                        // hit
+	assertCacheStats(t, f, CacheStats{Hits: 2, Misses: 1, Entries: 2, Bytes: 10})
+
+	// Empty and oversized values are not cached
+	putTestValues(t, f, "empty", "", "large", "12345678901")
+	readTestValue(t, f, "empty")
+	readTestValue(t, f, "large")
+	assertCacheStats(t, f, CacheStats{Hits: 2, Misses: 3, Entries: 2, Bytes: 10})
+}
+
+func TestValueCacheDisabled(t *testing.T) {
+	for _, maxBytes := range []int{0, -1} {
+		f := openTestFile(t, filepath.Join(t.TempDir(), "db"), ValueCache(maxBytes))
+		putTestValues(t, f, "a", "1")
+		readTestValue(t, f, "a")
+		assertCacheStats(t, f, CacheStats{})
+	}
+}
+
+func TestValueCacheClosed(t *testing.T) {
+	f := openTestFile(t, filepath.Join(t.TempDir(), "db"), ValueCache(1024))
+	putTestValues(t, f, "a", "1") // cached on commit
+	var version *Version
+	err := f.Read(func(r *Reader) error {
+		version = r.In('k').Seek([]byte("a")).History().Version(0)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = version.Value()
+	if !errors.Is(err, ErrClosed) {
+		t.Fatalf("got %v, want %v", err, ErrClosed)
+	}
+}
+
+func readTestValue(t *testing.T, f *File, key string) {
+	t.Helper()
+	err := f.Read(func(r *Reader) error {
+		_, err := r.In('k').Get([]byte(key))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertCacheStats(t *testing.T, f *File, want CacheStats) {
+	t.Helper()
+	if got := f.CacheStats(); got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
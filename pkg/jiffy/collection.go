@@ -0,0 +1,195 @@
+package jiffy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Codec encodes and decodes the keys or values of a typed collection.
+type Codec[T any] interface {
+	Encode(T) ([]byte, error)
+	Decode([]byte) (T, error)
+}
+
+// Collection wraps a group to put and get typed key-value pairs.
+//
+// Example:
+//
+//	users := jiffy.NewCollection[uint64, User](userGroupID, jiffy.Uint64Codec{}, jiffy.JSONCodec[User]{})
+//	err := f.ReadWrite(func(r *jiffy.Reader, w *jiffy.Writer) error {
+//		return users.Put(w, 7, User{Name: "James Bond"})
+//	})
+type Collection[K, V any] struct {
+	gid    GroupID
+	keys   Codec[K]
+	values Codec[V]
+}
+
+func NewCollection[K, V any](gid GroupID, keys Codec[K], values Codec[V]) *Collection[K, V] {
+	return &Collection[K, V]{gid: gid, keys: keys, values: values}
+}
+
+func (c *Collection[K, V]) GroupID() GroupID { return c.gid }
+
+func (c *Collection[K, V]) Put(w *Writer, key K, value V) error {
+	g, err := w.Group(c.gid)
+	if err != nil {
+		return err
+	}
+	k, err := c.keys.Encode(key)
+	if err != nil {
+		return fmt.Errorf("encode key: %w", err)
+	}
+	v, err := c.values.Encode(value)
+	if err != nil {
+		return fmt.Errorf("encode value: %w", err)
+	}
+	g.Put(k, v)
+	return nil
+}
+
+func (c *Collection[K, V]) Delete(w *Writer, key K) error {
+	g, err := w.Group(c.gid)
+	if err != nil {
+		return err
+	}
+	k, err := c.keys.Encode(key)
+	if err != nil {
+		return fmt.Errorf("encode key: %w", err)
+	}
+	g.Delete(k)
+	return nil
+}
+
+// Get returns the current value of a key, or ErrKeyNotFound if the key doesn't exist.
+func (c *Collection[K, V]) Get(r *Reader, key K) (V, error) {
+	var zero V
+	g, err := r.Group(c.gid)
+	if err != nil {
+		return zero, err
+	}
+	k, err := c.keys.Encode(key)
+	if err != nil {
+		return zero, fmt.Errorf("encode key: %w", err)
+	}
+	v, err := g.Get(k)
+	if err != nil {
+		return zero, err
+	}
+	value, err := c.values.Decode(v)
+	if err != nil {
+		return zero, fmt.Errorf("decode value: %w", err)
+	}
+	return value, nil
+}
+
+func (c *Collection[K, V]) Has(r *Reader, key K) (bool, error) {
+	g, err := r.Group(c.gid)
+	if err != nil {
+		return false, err
+	}
+	k, err := c.keys.Encode(key)
+	if err != nil {
+		return false, fmt.Errorf("encode key: %w", err)
+	}
+	return g.Seek(k) != nil, nil
+}
+
+// Each calls the given function for each key-value pair in chronological order (see GroupReader.Oldest).
+// If the function returns an error, the iteration stops and the error is returned.
+func (c *Collection[K, V]) Each(r *Reader, do func(key K, value V) error) error {
+	g, err := r.Group(c.gid)
+	if err != nil {
+		return err
+	}
+	for cursor := g.Oldest(); cursor != nil; cursor = cursor.Next() {
+		key, err := c.keys.Decode(cursor.Key())
+		if err != nil {
+			return fmt.Errorf("decode key %q: %w", cursor.Key(), err)
+		}
+		v, err := cursor.History().Value()
+		if err != nil {
+			return err
+		}
+		value, err := c.values.Decode(v)
+		if err != nil {
+			return fmt.Errorf("decode value of key %q: %w", cursor.Key(), err)
+		}
+		err = do(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSONCodec encodes values as JSON.
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(v T) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
+
+// GobCodec encodes values with encoding/gob.
+// Each value is encoded with its type information, so values are larger than with a shared gob stream.
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (GobCodec[T]) Decode(b []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+	return v, err
+}
+
+// BytesCodec stores byte slices as is.
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(v []byte) ([]byte, error) { return v, nil }
+func (BytesCodec) Decode(b []byte) ([]byte, error) { return b, nil }
+
+// StringCodec stores strings as is.
+type StringCodec struct{}
+
+func (StringCodec) Encode(v string) ([]byte, error) { return []byte(v), nil }
+func (StringCodec) Decode(b []byte) (string, error) { return string(b), nil }
+
+// Uint64Codec encodes integers on 8 big-endian bytes, so their byte order matches their numeric order.
+type Uint64Codec struct{}
+
+func (Uint64Codec) Encode(v uint64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, v), nil
+}
+
+func (Uint64Codec) Decode(b []byte) (uint64, error) {
+	if len(b) != 8 {
+		return 0, fmt.Errorf("invalid uint64 length %d", len(b))
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// Int64Codec encodes integers on 8 big-endian bytes with the sign bit flipped,
+// so their byte order matches their numeric order (negative numbers first).
+type Int64Codec struct{}
+
+func (Int64Codec) Encode(v int64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(nil, uint64(v)^(1<<63)), nil
+}
+
+func (Int64Codec) Decode(b []byte) (int64, error) {
+	if len(b) != 8 {
+		return 0, fmt.Errorf("invalid int64 length %d", len(b))
+	}
+	return int64(binary.BigEndian.Uint64(b) ^ (1 << 63)), nil
+}
@@ -0,0 +1,66 @@
+package jiffy
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+// Compression compresses values of at least threshold bytes with DEFLATE when they are put in the given groups
+// (or in all groups if none are given).
+// Compressed values are stored in OpPutDeflated lines, so files can mix compressed and uncompressed values.
+// Values whose compressed bytes can't be stored by the file format (ex: unescaped text format) are stored uncompressed.
+// Values are decompressed transparently when read.
+func Compression(threshold int, gids ...GroupID) Option {
+	return func(f *File) {
+		if f.compressThresholds == nil {
+			f.compressThresholds = map[GroupID]int{}
+		}
+		if len(gids) == 0 {
+			for gid := 0; gid < 256; gid++ {
+				f.compressThresholds[GroupID(gid)] = threshold
+			}
+		}
+		for _, gid := range gids {
+			f.compressThresholds[gid] = threshold
+		}
+	}
+}
+
+// compressLine returns a OpPutDeflated line if the value should be compressed and compression saves space.
+func (f *File) compressLine(l Line) (Line, error) {
+	threshold, ok := f.compressThresholds[l.GroupID]
+	if !ok || l.Op != OpPut || len(l.Value) < threshold {
+		return l, nil
+	}
+	buf := &bytes.Buffer{}
+	zw, err := flate.NewWriter(buf, flate.DefaultCompression)
+	if err != nil {
+		return l, err
+	}
+	_, err = zw.Write(l.Value)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return l, fmt.Errorf("compress value: %w", err)
+	}
+	if buf.Len() >= len(l.Value) {
+		return l, nil // not worth it
+	}
+	l.Op, l.Value = OpPutDeflated, buf.Bytes()
+	return l, nil
+}
+
+// lineValue returns the value of a put line, decompressing it if needed.
+func lineValue(l Line) ([]byte, error) {
+	if l.Op != OpPutDeflated {
+		return l.Value, nil
+	}
+	value, err := io.ReadAll(flate.NewReader(bytes.NewReader(l.Value)))
+	if err != nil {
+		return nil, fmt.Errorf("decompress value: %w", err)
+	}
+	return value, nil
+}
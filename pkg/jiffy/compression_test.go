@@ -0,0 +1,87 @@
+package jiffy
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		ffmt         FileFormat
+		wantDeflated bool // whether all values must be compressed
+	}{
+		{"text escaped", DefaultEscapedTextFileFormat, true},
+		{"text unescaped", DefaultTextFileFormat, false}, // compressed bytes may contain sentinels
+		{"binary", DefaultBinaryFileFormat, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fpath := filepath.Join(t.TempDir(), "db")
+			want := map[string]string{}
+			f, err := Open(fpath, tt.ffmt, testGroups, Compression(64))
+			if err != nil {
+				t.Fatal(err)
+			}
+			hasNewline := false // whether a compressed value contains the unescaped text format's value suffix
+			for i := 0; i < 100; i++ {
+				key, value := fmt.Sprint(i), compressibleTestValue(int64(i))
+				putTestValues(t, f, key, value)
+				want[key] = value
+				l, err := f.compressLine(Line{Op: OpPut, GroupID: 'k', Value: []byte(value)})
+				if err != nil {
+					t.Fatal(err)
+				}
+				hasNewline = hasNewline || bytes.IndexByte(l.Value, '\n') != -1
+			}
+			if !hasNewline {
+				t.Fatal("no compressed value contains a newline")
+			}
+			putTestValues(t, f, "short", "not compressed")
+			want["short"] = "not compressed"
+
+			err = f.Read(func(r *Reader) error {
+				for c := r.In('k').Oldest(); c != nil; c = c.Next() {
+					l, err := f.readLine(c.History().Version(0).Position)
+					if err != nil {
+						return err
+					}
+					isShort := string(c.Key()) == "short"
+					if isShort && l.Op != OpPut || tt.wantDeflated && !isShort && l.Op != OpPutDeflated {
+						return fmt.Errorf("key %q was written with op %q", c.Key(), l.Op)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertTestValues(t, f, want)
+			err = f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f, err = Open(fpath, tt.ffmt, testGroups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			assertTestValues(t, f, want)
+		})
+	}
+}
+
+// compressibleTestValue returns a random sequence of a few words.
+func compressibleTestValue(seed int64) string {
+	rnd := rand.New(rand.NewSource(seed))
+	words := []string{"alpha", "beta", "gamma", "delta", "epsilon"}
+	value := &strings.Builder{}
+	for i := 0; i < 100; i++ {
+		value.WriteString(words[rnd.Intn(len(words))] + " ")
+	}
+	return value.String()
+}
@@ -0,0 +1,78 @@
+package jiffy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Convert rewrites the linefile at src to a new file at dst using another file format.
+// Transactions, timestamps and commit boundaries are preserved, uncommitted tail lines are dropped.
+// If srcFmt is nil, the source format is detected from the file header.
+// If dstFmt is nil, the escaped text format is used.
+func Convert(src string, srcFmt FileFormat, dst string, dstFmt FileFormat) error {
+	if dstFmt == nil {
+		dstFmt = DefaultEscapedTextFileFormat
+	}
+	s, err := openLineScanner(src, srcFmt)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	fd, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return fmt.Errorf("create destination file: %w", err)
+	}
+	err = convertLines(s, fd, dstFmt)
+	if err == nil {
+		err = fd.Sync()
+	}
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+func convertLines(s *lineScanner, w io.Writer, dstFmt FileFormat) error {
+	bufw := bufio.NewWriter(w)
+	_, err := bufw.Write(encodeHeader(dstFmt))
+	if err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	var tx []Line // pending transaction, only written once committed
+	for {
+		_, l, err := s.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if l.Op != OpCommit {
+			tx = append(tx, l)
+			continue
+		}
+		for i := range tx {
+			tx[i].resolveAt(l.At)
+		}
+		setBeforeCommit(tx, l.At)
+		for _, txLine := range append(tx, l) {
+			encoded, err := dstFmt.Encode(txLine)
+			if err != nil {
+				return fmt.Errorf("encode transaction committed at offset %d: %w", s.offset, err)
+			}
+			_, err = bufw.Write(encoded)
+			if err != nil {
+				return fmt.Errorf("write transaction: %w", err)
+			}
+		}
+		tx = tx[:0]
+	}
+	return bufw.Flush()
+}
@@ -0,0 +1,93 @@
+package jiffy
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	f := openTestFile(t, src)
+	putTestValues(t, f, "a", "1", "b", "1")
+	err := f.ReadWrite(func(r *Reader, w *Writer) error {
+		w.Annotate("author", "test")
+		w.In('k').Put([]byte("a"), []byte("2"))
+		w.In('k').Delete([]byte("b"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendTestLines(t, src, DefaultEscapedTextFileFormat, envelopeTestLines(3, "c", "3")[:2]...) // uncommitted
+	want := map[string]string{"a": "2"}
+	wantAt := versionTestTimes(t, openTestFile(t, src, ReadOnly()))
+
+	for i, dstFmt := range []FileFormat{DefaultBinaryFileFormat, BinaryFileFormatV2{}, JSONLinesFileFormat{}, DefaultEscapedTextFileFormat} {
+		t.Run(describeFileFormat(dstFmt), func(t *testing.T) {
+			dst := filepath.Join(dir, describeFileFormat(dstFmt))
+			err := Convert(src, nil, dst, dstFmt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			converted := openTestFile(t, dst)
+			if converted.ffmt != dstFmt {
+				t.Fatalf("got format %q, want %q", describeFileFormat(converted.ffmt), describeFileFormat(dstFmt))
+			}
+			assertTestValues(t, converted, want)
+			assertLastTxID(t, converted, 2)
+			gotAt := versionTestTimes(t, converted)
+			if len(gotAt) != len(wantAt) {
+				t.Fatalf("got version timestamps %s, want %s", gotAt, wantAt)
+			}
+			for j := range wantAt {
+				if !gotAt[j].Equal(wantAt[j]) {
+					t.Fatalf("got version timestamps %s, want %s", gotAt, wantAt)
+				}
+			}
+			err = converted.Read(func(r *Reader) error {
+				tx, err := r.In('k').Seek([]byte("a")).History().Version(1).Tx()
+				if err != nil {
+					return err
+				}
+				if tx.ID != 2 || tx.Lines != 2 || tx.Metadata["author"] != "test" {
+					t.Fatalf("got transaction %+v, want transaction 2 with 2 lines and the author", tx)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Converting to an existing file fails
+			if i == 0 {
+				err = Convert(src, nil, dst, dstFmt)
+				if err == nil {
+					t.Fatal("got no error converting to an existing file")
+				}
+			}
+		})
+	}
+}
+
+// versionTestTimes returns the timestamps of the versions of key "a".
+func versionTestTimes(t *testing.T, f *File) []time.Time {
+	t.Helper()
+	var times []time.Time
+	err := f.Read(func(r *Reader) error {
+		h := r.In('k').Seek([]byte("a")).History()
+		for i := 0; i < h.Length(); i++ {
+			times = append(times, h.Version(i).At)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return times
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"time"
 )
 
@@ -18,16 +19,22 @@ type FileFormat interface {
 type Opcode uint8
 
 const (
-	OpPut    Opcode = '+' // create or update a key-value pair
-	OpDelete Opcode = '-' // delete and remove from history, erase at next merge
-	OpCommit Opcode = '.' // mark the end of a transaction
+	OpBegin        Opcode = '>' // mark the start of a transaction
+	OpPut          Opcode = '+' // create or update a key-value pair
+	OpPutDeflated  Opcode = '*' // same as OpPut, with a DEFLATE-compressed value (see Compression)
+	OpDelete       Opcode = '-' // delete and remove from history, erase at next merge
+	OpDeleteRange  Opcode = '~' // same as OpDelete, for keys from Key (inclusive) to Value (exclusive, unbounded if empty)
+	OpDeletePrefix Opcode = '^' // same as OpDelete, for keys starting with Key
+	OpClear        Opcode = '#' // same as OpDelete, for all keys of the group
+	OpCommit       Opcode = '.' // mark the end of a transaction
 )
 
 type GroupID byte
 
 const (
-	MaxKeyLength   = (1 << 8) - 1
-	MaxValueLength = (1 << 32) - 1
+	MaxKeyLength     = (1 << 8) - 1  // for BinaryFileFormat, which stores the key length on a single byte
+	MaxLongKeyLength = (1 << 16) - 1 // for other formats, since header version 2
+	MaxValueLength   = (1 << 32) - 1
 )
 
 var (
@@ -35,16 +42,18 @@ var (
 	ErrValueTooLong = errors.New("value too long")
 )
 
-func ValideKeyValueLengths(key, value []byte) error {
+func ValideKeyValueLengths(key, value []byte) error { return validateLengths(key, value, MaxKeyLength) }
+
+func validateLengths(key, value []byte, maxKeyLength int) error {
 	klen, vlen := len(key), len(value)
-	klenOverflows, vlenOverflows := klen > MaxKeyLength, vlen > MaxValueLength
+	klenOverflows, vlenOverflows := klen > maxKeyLength, vlen > MaxValueLength
 	switch {
 	case klenOverflows && vlenOverflows:
-		return fmt.Errorf("%w (%d B / 255 B) and %w (%d B / 4 GiB)", ErrKeyTooLong, klen, ErrValueTooLong, vlen)
+		return fmt.Errorf("%w (%d B / %d B) and %w (%d B / 4 GiB)", ErrKeyTooLong, klen, maxKeyLength, ErrValueTooLong, vlen)
 	case klenOverflows:
-		return fmt.Errorf("%w (%d B / 255 B)", ErrKeyTooLong, len(key))
+		return fmt.Errorf("%w (%d B / %d B)", ErrKeyTooLong, klen, maxKeyLength)
 	case vlenOverflows:
-		return fmt.Errorf("%w (%d B / 4 GiB)", ErrValueTooLong, len(value))
+		return fmt.Errorf("%w (%d B / 4 GiB)", ErrValueTooLong, vlen)
 	}
 	return nil
 }
@@ -58,6 +67,25 @@ type Line struct {
 	GroupID GroupID
 	Key     []byte
 	Value   []byte
+
+	// BeforeCommit is the time elapsed between the line and its transaction's commit.
+	// Formats that encode timestamps relative to the commit line (see BinaryFileFormatV2)
+	// decode lines with a zero timestamp, it is resolved when the commit line is read.
+	BeforeCommit time.Duration
+}
+
+// setBeforeCommit sets the time elapsed before the commit for the lines of a transaction.
+func setBeforeCommit(lines []Line, commitAt time.Time) {
+	for i := range lines {
+		lines[i].BeforeCommit = commitAt.Round(0).Sub(lines[i].At.Round(0)) // use wall clock readings
+	}
+}
+
+// resolveAt resolves the timestamp of a line decoded relative to its transaction's commit.
+func (l *Line) resolveAt(commitAt time.Time) {
+	if l.At.IsZero() {
+		l.At = commitAt.Add(-l.BeforeCommit)
+	}
 }
 
 type BinaryFileFormat struct{ ByteOrder binary.ByteOrder }
@@ -119,6 +147,7 @@ type TextFileFormat struct {
 	CharSuffixTimestamp byte
 	CharSuffixKey       byte
 	CharSuffixValue     byte
+	Escaped             bool // percent-encode sentinels and control characters in keys and values
 }
 
 var DefaultTextFileFormat = TextFileFormat{
@@ -130,8 +159,20 @@ var DefaultTextFileFormat = TextFileFormat{
 	CharSuffixValue:     '\n',
 }
 
+// DefaultEscapedTextFileFormat is the default text format with escaping enabled,
+// keys and values can contain arbitrary bytes.
+var DefaultEscapedTextFileFormat = TextFileFormat{
+	Base:                10,
+	CharSuffixOp:        ' ',
+	CharSuffixGroupID:   ' ',
+	CharSuffixTimestamp: ' ',
+	CharSuffixKey:       ' ',
+	CharSuffixValue:     '\n',
+	Escaped:             true,
+}
+
 func (tff TextFileFormat) Encode(l Line) ([]byte, error) {
-	err := ValideKeyValueLengths(l.Key, l.Value)
+	err := validateLengths(l.Key, l.Value, MaxLongKeyLength)
 	if err != nil {
 		return nil, err
 	}
@@ -141,6 +182,9 @@ func (tff TextFileFormat) Encode(l Line) ([]byte, error) {
 	if byte(l.GroupID) == tff.CharSuffixGroupID {
 		return nil, fmt.Errorf("group ID is equal to sentinel suffix %q", tff.CharSuffixGroupID)
 	}
+	if tff.Escaped {
+		l.Key, l.Value = tff.escape(l.Key, tff.CharSuffixKey), tff.escape(l.Value, tff.CharSuffixValue)
+	}
 	if i := bytes.IndexByte(l.Key, tff.CharSuffixKey); i != -1 {
 		return nil, fmt.Errorf("key contains sentinel suffix %q at index %d", tff.CharSuffixKey, i)
 	}
@@ -148,7 +192,7 @@ func (tff TextFileFormat) Encode(l Line) ([]byte, error) {
 		return nil, fmt.Errorf("value contains sentinel suffix %q at index %d", tff.CharSuffixValue, i)
 	}
 	b := []byte{byte(l.Op), tff.CharSuffixOp, byte(l.GroupID), tff.CharSuffixGroupID} // + op-suffix + group-suffix
-	b = append(b, l.At.Format(time.RFC3339)...)                                       // + timestamp
+	b = append(b, l.At.Format(time.RFC3339Nano)...)                                   // + timestamp
 	b = append(b, tff.CharSuffixTimestamp)                                            // + timestamp-suffix
 	b = append(b, l.Key...)                                                           // + key
 	b = append(b, tff.CharSuffixKey)                                                  // + key-suffix
@@ -183,7 +227,7 @@ func (tff TextFileFormat) Decode(r *bufio.Reader) (int64, Line, error) {
 	if err != nil {
 		return read, l, fmt.Errorf("read timestamp: %w", err)
 	}
-	l.At, err = time.Parse(time.RFC3339, string(tsAndSuffix[:len(tsAndSuffix)-1]))
+	l.At, err = time.Parse(time.RFC3339Nano, string(tsAndSuffix[:len(tsAndSuffix)-1])) // also accepts timestamps without fractional seconds
 	if err != nil {
 		return read, l, fmt.Errorf("parse timestamp: %w", err)
 	}
@@ -195,6 +239,12 @@ func (tff TextFileFormat) Decode(r *bufio.Reader) (int64, Line, error) {
 		return read, l, fmt.Errorf("read key: %w", err)
 	}
 	key := keyAndSuffix[:len(keyAndSuffix)-1]
+	if tff.Escaped {
+		key, err = tff.unescape(key)
+		if err != nil {
+			return read, l, fmt.Errorf("unescape key: %w", err)
+		}
+	}
 	if len(key) > 0 {
 		l.Key = key
 	} else {
@@ -208,6 +258,12 @@ func (tff TextFileFormat) Decode(r *bufio.Reader) (int64, Line, error) {
 		return read, l, fmt.Errorf("read value: %w", err)
 	}
 	value := valueAndSuffix[:len(valueAndSuffix)-1]
+	if tff.Escaped {
+		value, err = tff.unescape(value)
+		if err != nil {
+			return read, l, fmt.Errorf("unescape value: %w", err)
+		}
+	}
 	if len(value) > 0 {
 		l.Value = value
 	} else {
@@ -215,3 +271,50 @@ func (tff TextFileFormat) Decode(r *bufio.Reader) (int64, Line, error) {
 	}
 	return read, l, nil
 }
+
+const textEscapeChar = '%'
+
+// escape percent-encodes the escape character, the slot's sentinel suffix and control characters.
+func (tff TextFileFormat) escape(b []byte, sentinel byte) []byte {
+	const hex = "0123456789ABCDEF"
+	var escaped []byte
+	for i, c := range b {
+		if c != textEscapeChar && c != sentinel && c >= 0x20 && c != 0x7f {
+			if escaped != nil {
+				escaped = append(escaped, c)
+			}
+			continue
+		}
+		if escaped == nil {
+			escaped = append(make([]byte, 0, len(b)+8), b[:i]...) // only allocate when needed
+		}
+		escaped = append(escaped, textEscapeChar, hex[c>>4], hex[c&0xf])
+	}
+	if escaped == nil {
+		return b
+	}
+	return escaped
+}
+
+func (tff TextFileFormat) unescape(b []byte) ([]byte, error) {
+	if bytes.IndexByte(b, textEscapeChar) == -1 {
+		return b, nil
+	}
+	unescaped := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] != textEscapeChar {
+			unescaped = append(unescaped, b[i])
+			continue
+		}
+		if i+2 >= len(b) {
+			return nil, fmt.Errorf("truncated escape sequence at index %d", i)
+		}
+		c, err := strconv.ParseUint(string(b[i+1:i+3]), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid escape sequence at index %d: %w", i, err)
+		}
+		unescaped = append(unescaped, byte(c))
+		i += 2
+	}
+	return unescaped, nil
+}
@@ -0,0 +1,227 @@
+package jiffy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fileFormatTests lists the file formats covered by the encoding tests.
+var fileFormatTests = []struct {
+	name         string
+	ffmt         FileFormat
+	maxKeyLength int
+}{
+	{"binary", DefaultBinaryFileFormat, MaxKeyLength},
+	{"text escaped", DefaultEscapedTextFileFormat, MaxLongKeyLength},
+	{"text escaped with custom suffixes", TextFileFormat{
+		Base:                10,
+		CharSuffixOp:        '|',
+		CharSuffixGroupID:   '|',
+		CharSuffixTimestamp: '|',
+		CharSuffixKey:       '=',
+		CharSuffixValue:     ';',
+		Escaped:             true,
+	}, MaxLongKeyLength},
+	{"jsonl", JSONLinesFileFormat{}, MaxLongKeyLength},
+	{"binary v2", BinaryFileFormatV2{}, MaxLongKeyLength},
+	{"encrypted binary", mustEncryptedFileFormat(DefaultBinaryFileFormat), MaxLongKeyLength},
+	{"encrypted text escaped", mustEncryptedFileFormat(DefaultEscapedTextFileFormat), MaxLongKeyLength},
+	{"encrypted jsonl", mustEncryptedFileFormat(JSONLinesFileFormat{}), MaxLongKeyLength},
+	{"encrypted binary v2", mustEncryptedFileFormat(BinaryFileFormatV2{}), MaxLongKeyLength},
+}
+
+var fileFormatTestGroups = map[GroupID]int{'k': 1}
+
+func mustEncryptedFileFormat(inner FileFormat) *EncryptedFileFormat {
+	eff, err := NewEncryptedFileFormat(inner, 1, map[byte][]byte{1: bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		panic(err)
+	}
+	return eff
+}
+
+// allBytes returns n bytes cycling through all byte values.
+func allBytes(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func testLines(maxKeyLength int) []Line {
+	at := time.Unix(1700000000, 123456789)
+	return []Line{
+		{Op: OpBegin, At: at, GroupID: GroupID(OpBegin), Key: []byte("1"), BeforeCommit: 3 * time.Second},
+		{Op: OpPut, At: at, GroupID: 'a', Key: allBytes(min(maxKeyLength, 256)), Value: allBytes(1024), BeforeCommit: 2 * time.Second},
+		{Op: OpPut, At: at, GroupID: 0, Key: bytes.Repeat([]byte{'k'}, maxKeyLength), BeforeCommit: time.Nanosecond},
+		{Op: OpPut, At: at, GroupID: 'a'}, // empty key and value
+		{Op: OpDelete, At: at, GroupID: 'a', Key: []byte(" %\n=;|%41")},
+		{Op: OpCommit, At: at, GroupID: GroupID(OpCommit), Key: []byte("1"), Value: []byte("crc32=00000000&lines=4")},
+	}
+}
+
+func TestFileFormatRoundTrip(t *testing.T) {
+	for _, tt := range fileFormatTests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := testLines(tt.maxKeyLength)
+			buf := []byte{}
+			lengths := []int{}
+			for _, l := range lines {
+				encoded, err := tt.ffmt.Encode(l)
+				if err != nil {
+					t.Fatalf("encode %q line: %v", l.Op, err)
+				}
+				buf = append(buf, encoded...)
+				lengths = append(lengths, len(encoded))
+			}
+			r := bufio.NewReader(bytes.NewReader(buf))
+			for i, want := range lines {
+				n, got, err := tt.ffmt.Decode(r)
+				if err != nil {
+					t.Fatalf("decode line %d: %v", i, err)
+				}
+				if n != int64(lengths[i]) {
+					t.Fatalf("line %d: decoded %d bytes, encoded %d bytes", i, n, lengths[i])
+				}
+				assertLineEqual(t, got, want)
+			}
+			_, _, err := tt.ffmt.Decode(r)
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("decode after last line: got %v, want %v", err, io.EOF)
+			}
+		})
+	}
+}
+
+func TestFileFormatKeyTooLong(t *testing.T) {
+	for _, tt := range fileFormatTests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := Line{Op: OpPut, At: time.Now(), GroupID: 'a', Key: make([]byte, tt.maxKeyLength+1)}
+			_, err := tt.ffmt.Encode(l)
+			if !errors.Is(err, ErrKeyTooLong) {
+				t.Fatalf("got %v, want %v", err, ErrKeyTooLong)
+			}
+		})
+	}
+}
+
+// Replay stops at incomplete lines, so each format must report truncated lines as io.EOF or io.ErrUnexpectedEOF.
+func TestFileFormatTruncatedTail(t *testing.T) {
+	for _, tt := range fileFormatTests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := Line{Op: OpPut, At: time.Now(), GroupID: 'a', Key: allBytes(64), Value: allBytes(256)}
+			encoded, err := tt.ffmt.Encode(l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for n := 0; n < len(encoded); n++ {
+				_, _, err := tt.ffmt.Decode(bufio.NewReader(bytes.NewReader(encoded[:n])))
+				if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("decode %d of %d bytes: got %v, want io.EOF or io.ErrUnexpectedEOF", n, len(encoded), err)
+				}
+			}
+		})
+	}
+}
+
+// Timestamps must keep their nanoseconds once written and replayed.
+func TestFileFormatReopenTimestamp(t *testing.T) {
+	for _, tt := range fileFormatTests {
+		t.Run(tt.name, func(t *testing.T) {
+			fpath := filepath.Join(t.TempDir(), "db")
+			key := []byte("key")
+			versionAt := func(f *File) (at time.Time) {
+				err := f.Read(func(r *Reader) error {
+					c := r.In('k').Seek(key)
+					if c == nil {
+						return errors.New("key not found")
+					}
+					at = c.History().Version(0).At
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return at
+			}
+
+			f, err := Open(fpath, tt.ffmt, fileFormatTestGroups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = f.ReadWrite(func(r *Reader, w *Writer) error {
+				w.In('k').Put(key, []byte("value"))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := versionAt(f)
+			err = f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f, err = Open(fpath, tt.ffmt, fileFormatTestGroups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if got := versionAt(f); !got.Equal(want) {
+				t.Fatalf("got timestamp %s after reopening, want %s", got.Format(time.RFC3339Nano), want.Format(time.RFC3339Nano))
+			}
+		})
+	}
+}
+
+func TestEncryptedFileFormatRejectsUnescapedText(t *testing.T) {
+	for _, inner := range []FileFormat{DefaultTextFileFormat, &DefaultTextFileFormat} {
+		_, err := NewEncryptedFileFormat(inner, 1, map[byte][]byte{1: bytes.Repeat([]byte{1}, 32)})
+		if err == nil {
+			t.Fatalf("inner format %T: got no error", inner)
+		}
+	}
+}
+
+func TestEncryptedFileFormatHidesTimestamp(t *testing.T) {
+	inner := DefaultEscapedTextFileFormat
+	at := time.Unix(1700000000, 123456789)
+	encoded, err := mustEncryptedFileFormat(inner).Encode(Line{Op: OpPut, At: at, GroupID: 'a', Key: []byte("k")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, l, err := inner.Decode(bufio.NewReader(bytes.NewReader(encoded)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.At.Equal(encryptedLineAt) {
+		t.Fatalf("got clear text timestamp %s, want %s", l.At, encryptedLineAt)
+	}
+}
+
+func assertLineEqual(t *testing.T, got, want Line) {
+	t.Helper()
+	if got.Op != want.Op || got.GroupID != want.GroupID {
+		t.Fatalf("got op %q in group %d, want op %q in group %d", got.Op, got.GroupID, want.Op, want.GroupID)
+	}
+	if !bytes.Equal(got.Key, want.Key) {
+		t.Fatalf("%q line: got key %q, want %q", want.Op, got.Key, want.Key)
+	}
+	if !bytes.Equal(got.Value, want.Value) {
+		t.Fatalf("%q line: got value %q, want %q", want.Op, got.Value, want.Value)
+	}
+	switch {
+	case got.At.IsZero(): // timestamp relative to the commit (see BinaryFileFormatV2)
+		if got.BeforeCommit != want.BeforeCommit {
+			t.Fatalf("%q line: got %s before commit, want %s", want.Op, got.BeforeCommit, want.BeforeCommit)
+		}
+	case !got.At.Equal(want.At):
+		t.Fatalf("%q line: got timestamp %s, want %s", want.Op, got.At, want.At)
+	}
+}
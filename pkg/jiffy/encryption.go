@@ -0,0 +1,129 @@
+package jiffy
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrDecrypt = errors.New("decrypt line")
+
+// encryptedLineAt is the clear text timestamp of encrypted lines.
+var encryptedLineAt = time.Unix(0, 0).UTC()
+
+// EncryptedFileFormat wraps a file format and seals each line's timestamp, key and value with AES-GCM.
+// The op and group ID stay in clear text and are authenticated.
+// The sealed payload is stored in the value slot of the wrapped format:
+//
+//	key ID + nonce + sealed(timestamp (varint) + klen (uvarint) + key + value)
+//
+// The wrapped format must support arbitrary bytes in values (ex: binary or escaped text formats),
+// unescaped text formats are rejected.
+// Lines can be decrypted with any of the given keys, and are encrypted with the active key.
+// To rotate keys, convert the file with a format whose active key is the new key (see Convert).
+type EncryptedFileFormat struct {
+	Inner       FileFormat
+	activeKeyID byte
+	aeads       map[byte]cipher.AEAD
+}
+
+// NewEncryptedFileFormat creates an encrypted file format using AES keys of 16, 24 or 32 bytes.
+func NewEncryptedFileFormat(inner FileFormat, activeKeyID byte, keys map[byte][]byte) (*EncryptedFileFormat, error) {
+	if tff, ok := inner.(TextFileFormat); ok && !tff.Escaped {
+		return nil, errors.New("inner text format must be escaped to store sealed bytes")
+	}
+	if tff, ok := inner.(*TextFileFormat); ok && !tff.Escaped {
+		return nil, errors.New("inner text format must be escaped to store sealed bytes")
+	}
+	if _, ok := keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active key %d not found", activeKeyID)
+	}
+	eff := &EncryptedFileFormat{Inner: inner, activeKeyID: activeKeyID, aeads: make(map[byte]cipher.AEAD, len(keys))}
+	for keyID, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", keyID, err)
+		}
+		eff.aeads[keyID], err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", keyID, err)
+		}
+	}
+	return eff, nil
+}
+
+func (eff *EncryptedFileFormat) Descriptor() string {
+	return "aes-gcm " + describeFileFormat(eff.Inner)
+}
+
+func (eff *EncryptedFileFormat) Encode(l Line) ([]byte, error) {
+	err := validateLengths(l.Key, l.Value, MaxLongKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	aead := eff.aeads[eff.activeKeyID]
+	plaintext := make([]byte, 0, 2*binary.MaxVarintLen64+len(l.Key)+len(l.Value))
+	plaintext = binary.AppendVarint(plaintext, l.At.UnixNano())     // + timestamp
+	plaintext = binary.AppendUvarint(plaintext, uint64(len(l.Key))) // + klen
+	plaintext = append(append(plaintext, l.Key...), l.Value...)     // + key + value
+	sealed := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	sealed[0] = eff.activeKeyID    // + key ID
+	_, err = rand.Read(sealed[1:]) // + nonce
+	if err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed = aead.Seal(sealed, sealed[1:], plaintext, eff.additionalData(l)) // + sealed payload
+	l.Key, l.Value = nil, sealed
+	l.At, l.BeforeCommit = encryptedLineAt, 0 // only stored in the sealed payload
+	return eff.Inner.Encode(l)
+}
+
+func (eff *EncryptedFileFormat) Decode(r *bufio.Reader) (int64, Line, error) {
+	read, l, err := eff.Inner.Decode(r)
+	if err != nil {
+		return read, l, err
+	}
+	if len(l.Value) == 0 {
+		return read, l, fmt.Errorf("%w: missing key ID", ErrDecrypt)
+	}
+	aead, ok := eff.aeads[l.Value[0]]
+	if !ok {
+		return read, l, fmt.Errorf("%w: unknown key %d", ErrDecrypt, l.Value[0])
+	}
+	if len(l.Value) < 1+aead.NonceSize() {
+		return read, l, fmt.Errorf("%w: missing nonce", ErrDecrypt)
+	}
+	nonce, sealed := l.Value[1:1+aead.NonceSize()], l.Value[1+aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, eff.additionalData(l))
+	if err != nil {
+		return read, l, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+	at, n := binary.Varint(plaintext)
+	if n <= 0 {
+		return read, l, fmt.Errorf("%w: invalid timestamp", ErrDecrypt)
+	}
+	plaintext = plaintext[n:]
+	klen, n := binary.Uvarint(plaintext)
+	if n <= 0 || klen > uint64(len(plaintext)-n) {
+		return read, l, fmt.Errorf("%w: invalid key length", ErrDecrypt)
+	}
+	plaintext = plaintext[n:]
+	l.At, l.Key, l.Value = time.Unix(0, at), plaintext[:klen], plaintext[klen:]
+	if len(l.Key) == 0 {
+		l.Key = nil
+	}
+	if len(l.Value) == 0 {
+		l.Value = nil
+	}
+	return read, l, nil
+}
+
+// additionalData returns the clear text header fields authenticated along with the sealed payload.
+func (eff *EncryptedFileFormat) additionalData(l Line) []byte {
+	return []byte{byte(l.Op), byte(l.GroupID)}
+}
@@ -2,6 +2,7 @@ package jiffy
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -9,34 +10,89 @@ import (
 	"sync"
 )
 
+var (
+	ErrLocked        = errors.New("file is locked")
+	ErrReadOnly      = errors.New("file is read-only")
+	ErrTailCorrupted = errors.New("file tail is corrupted")
+	ErrGroupNotFound = errors.New("group not found")
+	ErrKeyNotFound   = errors.New("key not found")
+	ErrClosed        = errors.New("file is closed")
+)
+
 // File holds the in-memory state of a linefile and wraps operations on the underlying file.
 type File struct {
-	mu         sync.RWMutex
-	fpath      string          // Underlying file's path
-	fsize      int64           // Current file size (= write offset)
-	ffmt       FileFormat      // File encoding format
-	r, w       *os.File        // OS file handlers (for reads and writes)
-	memidxs    [256]*memindex  // Collections (= ordered-maps of key-value pairs)
-	numBuckets map[GroupID]int // Collections' number of hashtable buckets (seperate chaining)
+	mu                 sync.RWMutex
+	fpath              string          // Underlying file's path
+	fsize              int64           // Current file size (= write offset)
+	ffmt               FileFormat      // File encoding format
+	r, w               *os.File        // OS file handlers (for reads and writes)
+	memidxs            [256]*memindex  // Collections (= ordered-maps of key-value pairs)
+	numBuckets         map[GroupID]int // Collections' number of hashtable buckets (seperate chaining)
+	readOnly           bool            // Whether the file was opened in read-only mode
+	headerVersion      int             // File header version (0 for files without header)
+	headerLength       int64           // File header length (0 for files without header)
+	compressThresholds map[GroupID]int // Minimum value length to compress per group (see Compression)
+	lastTxID           uint64          // ID of the last committed transaction
+	following          bool            // Whether the file is currently replicating a leader (see Follow)
+	commitc            chan struct{}   // Closed and replaced on each commit (see notifyCommit)
+	closed             bool            // Whether Close was called
+	indexDefs          []indexDef      // Secondary indexes (see Index)
+	cache              *valueCache     // Recently used values (nil if disabled, see ValueCache)
+	uncommittedTail    int64           // Length of the uncommitted data following fsize (only kept in read-only mode)
 }
 
+// Option configures how a file is opened.
+type Option func(f *File)
+
+// ReadOnly opens the file without write access.
+// The file is never created or truncated and read-write transactions return ErrReadOnly.
+// Uncommitted data at the end of the file is ignored and reported by UncommittedTail.
+// Read-only opens don't take the file lock, which only keeps out other writers:
+// a file can be opened in read-only mode while a writer has it open, the transactions committed
+// after the memstate was loaded are not visible.
+func ReadOnly() Option { return func(f *File) { f.readOnly = true } }
+
 // Open opens a file and scans it to restore the memstate.
-func Open(fpath string, ffmt FileFormat, numBuckets map[GroupID]int) (*File, error) {
+// Unless the file is opened in read-only mode, an exclusive lock is taken on platforms that support it,
+// so that a single writer has the file open (ErrLocked is returned otherwise).
+// If ffmt is nil, the file format is detected from the file header (or the escaped text format is used for new files).
+func Open(fpath string, ffmt FileFormat, numBuckets map[GroupID]int, opts ...Option) (*File, error) {
 	if fpath == "" {
 		return nil, errors.New("missing file path")
 	}
-	if ffmt == nil {
-		ffmt = DefaultTextFileFormat
+	f := &File{fpath: fpath, ffmt: ffmt, numBuckets: numBuckets, commitc: make(chan struct{})}
+	for _, opt := range opts {
+		opt(f)
 	}
-	f := &File{fpath: fpath, ffmt: ffmt, numBuckets: numBuckets}
 	err := f.initMemstate()
 	if err != nil {
+		if f.r != nil {
+			_ = f.closeFiles() // release file descriptors and lock
+		}
 		return nil, err
 	}
 	return f, nil
 }
 
+// Close waits for in-flight transactions to finish, then releases the file descriptors and lock.
+// Calling Close again has no effect, other operations return ErrClosed.
 func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.notifyCommit() // wake up replication streams so they stop
+	f.cache.close()
+	return f.closeFiles()
+}
+
+// closeFiles closes the file descriptors (which releases the lock).
+func (f *File) closeFiles() error {
+	if f.w == nil {
+		return f.r.Close()
+	}
 	rErr, wErr := f.r.Close(), f.w.Close()
 	if hasRErr, hasWErr := rErr != nil, wErr != nil; hasRErr || hasWErr {
 		return fmt.Errorf("close files: (failed r=%v/w=%v) %w, %w", hasRErr, hasWErr, rErr, wErr)
@@ -45,8 +101,8 @@ func (f *File) Close() error {
 }
 
 func (f *File) initMemstate() error {
-	if f.r != nil && f.w != nil {
-		err := f.Close() // close open file descriptors if any
+	if f.r != nil {
+		err := f.closeFiles() // close open file descriptors if any
 		if err != nil {
 			return fmt.Errorf("close open file descriptors: %w", err)
 		}
@@ -54,13 +110,26 @@ func (f *File) initMemstate() error {
 
 	// Open file descriptors
 	var err error
-	f.r, err = os.OpenFile(f.fpath, os.O_RDONLY|os.O_CREATE, 0666)
-	if err != nil {
-		return fmt.Errorf("open or create read-only file: %w", err)
+	if f.readOnly {
+		f.r, err = os.OpenFile(f.fpath, os.O_RDONLY, 0)
+		if err != nil {
+			return fmt.Errorf("open read-only file: %w", err)
+		}
+	} else {
+		f.r, err = os.OpenFile(f.fpath, os.O_RDONLY|os.O_CREATE, 0666)
+		if err != nil {
+			return fmt.Errorf("open or create read-only file: %w", err)
+		}
 	}
-	f.w, err = os.OpenFile(f.fpath, os.O_WRONLY, 0666)
-	if err != nil {
-		return fmt.Errorf("open write-only file: %w", err)
+	if !f.readOnly {
+		err = lockFile(f.r)
+		if err != nil {
+			return fmt.Errorf("lock %q: %w", f.fpath, err)
+		}
+		f.w, err = os.OpenFile(f.fpath, os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			return fmt.Errorf("open write-only file: %w", err)
+		}
 	}
 
 	// Rebuild memstate
@@ -68,49 +137,182 @@ func (f *File) initMemstate() error {
 	for cID, cNumBuckets := range f.numBuckets {
 		f.memidxs[cID] = newMemindex(cNumBuckets)
 	}
-	f.fsize = 0
+	err = f.initIndexes()
+	if err != nil {
+		return err
+	}
 	bufr := bufio.NewReader(f.r)
-	truncateAt := int64(0)
+	headerLength, err := f.initHeader(bufr)
+	if err != nil {
+		return err
+	}
+	f.headerLength = headerLength
+	committed, read, err := f.replay(bufr, headerLength)
+	f.fsize = read
+	if err != nil {
+		return err
+	}
+	if committed < read {
+		if f.readOnly {
+			f.fsize, f.uncommittedTail = committed, read-committed // leave the file untouched
+			return nil
+		}
+		f.mustTruncateTailCorruption(committed)
+	}
+	return nil
+}
+
+// UncommittedTail reports uncommitted data left at the end of a file opened in read-only mode,
+// for example by a crash during a transaction (read-write opens truncate it).
+// It returns the offset where the uncommitted data starts and ErrTailCorrupted,
+// or the file size and nil if the file ends with a committed transaction.
+func (f *File) UncommittedTail() (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.uncommittedTail > 0 {
+		return f.fsize, fmt.Errorf("%w: %d bytes of uncommitted data at offset %d", ErrTailCorrupted, f.uncommittedTail, f.fsize)
+	}
+	return f.fsize, nil
+}
+
+// initHeader writes the header of new files or checks the header of existing files,
+// and resolves the file format accordingly. It returns the header length.
+func (f *File) initHeader(r *bufio.Reader) (int64, error) {
+	stat, err := f.r.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat file: %w", err)
+	}
+	if stat.Size() > 0 || f.readOnly {
+		headerLength, err := f.checkHeader(r)
+		if !errors.Is(err, io.ErrUnexpectedEOF) || f.readOnly {
+			return headerLength, err
+		}
+
+		// Nothing is written after an incomplete header, rewrite the header
+		err = f.w.Truncate(0)
+		if err != nil {
+			return 0, fmt.Errorf("truncate incomplete header: %w", err)
+		}
+		_, err = f.r.Seek(0, io.SeekStart)
+		if err != nil {
+			return 0, fmt.Errorf("seek file start: %w", err)
+		}
+		r.Reset(f.r)
+	}
+	if f.ffmt == nil {
+		f.ffmt = DefaultEscapedTextFileFormat
+	}
+	f.headerVersion = HeaderVersion
+	header := encodeHeader(f.ffmt)
+	_, err = f.w.Write(header)
+	if err == nil {
+		err = f.w.Sync()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("write header: %w", err)
+	}
+	_, err = r.Discard(len(header)) // skip header for replay
+	if err != nil {
+		return 0, fmt.Errorf("skip header: %w", err)
+	}
+	return int64(len(header)), nil
+}
+
+// checkHeader reads the header of an existing file and resolves the file format accordingly.
+func (f *File) checkHeader(r *bufio.Reader) (int64, error) {
+	var descriptor string
+	var headerLength int64
+	var err error
+	f.headerVersion, descriptor, headerLength, err = readHeader(r)
+	if err != nil {
+		return headerLength, err
+	}
+	f.ffmt, err = resolveFileFormat(f.ffmt, descriptor)
+	if err != nil {
+		return headerLength, fmt.Errorf("%q: %w", f.fpath, err)
+	}
+	return headerLength, nil
+}
+
+// replay decodes lines starting at the given file offset and applies committed transactions to the memstate.
+// It returns the offset following the last commit line and the offset where reading stopped (on EOF).
+func (f *File) replay(r *bufio.Reader, offset int64) (committed, read int64, err error) {
+	committed, read = offset, offset
 	var txLines []txReplayLine
+	txv := &txVerifier{lastID: f.lastTxID} // replication replays frames following the last transaction
 	for {
-		lineStart := f.fsize
-		lineLength, l, err := f.ffmt.Decode(bufr)
-		f.fsize += lineLength
-		if errors.Is(err, io.EOF) {
-			if lineLength > 0 {
-				f.mustTruncateTailCorruption(truncateAt) // We reached EOF on a corrupted row.
-			}
-			break // We reached the end of the file, all good!
+		lineStart := read
+		lineLength, l, err := f.ffmt.Decode(r)
+		read += lineLength
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return committed, read, nil // We reached the end of the file, the caller handles incomplete lines.
 		}
 		if err != nil {
-			return fmt.Errorf("read row at offset %d: %w", lineStart, err)
+			return committed, read, fmt.Errorf("read row at offset %d: %w", lineStart, err)
 		}
 		switch l.Op {
 		default:
-			return fmt.Errorf("illegal op %q at offset %d", l.Op, lineStart)
-		case OpDelete, OpPut:
+			return committed, read, fmt.Errorf("illegal op %q at offset %d", l.Op, lineStart)
+		case OpBegin:
+			err = txv.begin(l, len(txLines))
+			if err != nil {
+				return committed, read, fmt.Errorf("begin line at offset %d: %w", lineStart, err)
+			}
+		case OpDelete, OpDeleteRange, OpDeletePrefix, OpClear, OpPut, OpPutDeflated:
+			txv.add(l)
 			txLines = append(txLines, txReplayLine{p: NewPosition(lineStart, lineLength), l: l})
 		case OpCommit:
-			for _, txLine := range txLines {
-				collMemindex := f.memidxs[txLine.l.GroupID]
-				if collMemindex == nil {
-					return fmt.Errorf("collection ID %d not found in memstate", txLine.l.GroupID)
-				}
-				switch txLine.l.Op {
-				case OpPut:
-					collMemindex.put(txLine.l.Key, txLine.l.At, txLine.p)
-				case OpDelete:
-					collMemindex.delete(txLine.l.Key)
-				}
+			txID, err := txv.commit(l)
+			if err != nil {
+				return committed, read, fmt.Errorf("commit line at offset %d: %w", lineStart, err)
+			}
+			if txID != 0 { // zero for transactions written without envelope
+				f.lastTxID = txID
+			}
+			for i := range txLines {
+				txLines[i].l.resolveAt(l.At)
+			}
+			err = f.applyTx(txLines, NewPosition(lineStart, lineLength))
+			if err != nil {
+				return committed, read, fmt.Errorf("apply transaction committed at offset %d: %w", lineStart, err)
 			}
 			txLines = nil
-			truncateAt = f.fsize
+			committed = read
 		}
 	}
-	if len(txLines) > 0 {
-		f.mustTruncateTailCorruption(truncateAt)
-	}
+}
 
+// applyTx applies the lines of a committed transaction to the memstate.
+func (f *File) applyTx(txLines []txReplayLine, commit Position) error {
+	for _, txLine := range txLines {
+		if f.memidxs[txLine.l.GroupID] == nil {
+			return fmt.Errorf("%w: collection ID %d not found in memstate", ErrGroupNotFound, txLine.l.GroupID)
+		}
+	}
+	for _, txLine := range txLines {
+		gmidx := f.memidxs[txLine.l.GroupID]
+		switch txLine.l.Op {
+		case OpPut, OpPutDeflated:
+			gmidx.put(txLine.l.Key, txLine.l.At, txLine.p, commit)
+			if len(gmidx.indexes) > 0 {
+				value, err := lineValue(txLine.l)
+				if err != nil {
+					return fmt.Errorf("index key %q: %w", txLine.l.Key, err)
+				}
+				for _, idx := range gmidx.indexes {
+					idx.put(txLine.l.Key, value)
+				}
+			}
+		case OpDelete:
+			gmidx.delete(txLine.l.Key)
+		case OpDeleteRange:
+			gmidx.deleteMatching(func(key []byte) bool { return keyInRange(key, txLine.l.Key, txLine.l.Value) })
+		case OpDeletePrefix:
+			gmidx.deleteMatching(func(key []byte) bool { return bytes.HasPrefix(key, txLine.l.Key) })
+		case OpClear:
+			gmidx.clear()
+		}
+	}
 	return nil
 }
 
@@ -118,3 +320,26 @@ type txReplayLine struct {
 	p Position
 	l Line
 }
+
+// notifyCommit wakes up goroutines waiting for new transactions.
+// It must be called with the write lock held.
+func (f *File) notifyCommit() {
+	close(f.commitc)
+	f.commitc = make(chan struct{})
+}
+
+// checkOpen returns ErrClosed if the file was closed. It must be called with the lock held.
+func (f *File) checkOpen() error {
+	if f.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// wrapClosed marks errors caused by reading a file closed concurrently with ErrClosed.
+func wrapClosed(err error) error {
+	if errors.Is(err, os.ErrClosed) {
+		return fmt.Errorf("%w: %w", ErrClosed, err)
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package jiffy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenUncommittedTail(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "db")
+	f := openTestFile(t, fpath)
+	putTestValues(t, f, "a", "1")
+	committed := f.fsize
+	err := f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendTestLines(t, fpath, DefaultEscapedTextFileFormat,
+		Line{Op: OpBegin, At: time.Now(), GroupID: GroupID(OpBegin), Key: encodeTxID(2)},
+		Line{Op: OpPut, At: time.Now(), GroupID: 'k', Key: []byte("b"), Value: []byte("2")},
+	)
+	stat, err := os.Stat(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read-only opens load the committed transactions and leave the tail untouched
+	f = openTestFile(t, fpath, ReadOnly())
+	assertTestValues(t, f, map[string]string{"a": "1"})
+	offset, err := f.UncommittedTail()
+	if !errors.Is(err, ErrTailCorrupted) || offset != committed {
+		t.Fatalf("got offset %d and %v, want offset %d and %v", offset, err, committed, ErrTailCorrupted)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after, err := os.Stat(fpath); err != nil || after.Size() != stat.Size() {
+		t.Fatalf("read-only open changed the file size from %d to %d (%v)", stat.Size(), after.Size(), err)
+	}
+
+	// Read-write opens truncate the tail
+	f = openTestFile(t, fpath)
+	offset, err = f.UncommittedTail()
+	if err != nil || offset != committed {
+		t.Fatalf("got offset %d and %v, want offset %d and no error", offset, err, committed)
+	}
+	putTestValues(t, f, "c", "3")
+	assertTestValues(t, f, map[string]string{"a": "1", "c": "3"})
+}
+
+// appendTestLines appends raw encoded lines to a file.
+func appendTestLines(t *testing.T, fpath string, ffmt FileFormat, lines ...Line) {
+	t.Helper()
+	fd, err := os.OpenFile(fpath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	for _, l := range lines {
+		encoded, err := ffmt.Encode(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = fd.Write(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOpenIncompleteHeader(t *testing.T) {
+	for _, content := range []string{"jif", "jiffy 2 te"} {
+		t.Run(content, func(t *testing.T) {
+			fpath := filepath.Join(t.TempDir(), "db")
+			err := os.WriteFile(fpath, []byte(content), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := openTestFile(t, fpath)
+			putTestValues(t, f, "a", "1")
+			err = f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f = openTestFile(t, fpath)
+			if f.headerVersion != HeaderVersion {
+				t.Fatalf("got header version %d, want %d", f.headerVersion, HeaderVersion)
+			}
+			assertTestValues(t, f, map[string]string{"a": "1"})
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package jiffy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A linefile starts with a header line identifying the format it was written with:
+//
+//	jiffy <version> <format descriptor>\n
+//
+// Files written before headers were introduced have no header and are read with the default text format.
+//
+// Header versions:
+//   - 1: keys are limited to MaxKeyLength in all formats.
+//   - 2: keys are limited to MaxLongKeyLength, except in BinaryFileFormat.
+//
+// Files with an older header version are still supported.
+const (
+	headerMagic   = "jiffy "
+	HeaderVersion = 2
+)
+
+var ErrFormatMismatch = errors.New("file format mismatch")
+
+// DescribedFileFormat is implemented by file formats that can be identified from a linefile header.
+// The descriptor includes the format options and can be parsed with ParseFileFormat.
+type DescribedFileFormat interface {
+	FileFormat
+	Descriptor() string
+}
+
+func (bff BinaryFileFormat) Descriptor() string { return "binary " + bff.ByteOrder.String() }
+
+func (tff TextFileFormat) Descriptor() string {
+	descriptor := fmt.Sprintf("text %d %02x %02x %02x %02x %02x", tff.Base,
+		tff.CharSuffixOp, tff.CharSuffixGroupID, tff.CharSuffixTimestamp, tff.CharSuffixKey, tff.CharSuffixValue)
+	if tff.Escaped {
+		descriptor += " escaped"
+	}
+	return descriptor
+}
+
+// describeFileFormat returns the descriptor of a file format.
+// Formats that don't implement DescribedFileFormat are identified by their Go type.
+func describeFileFormat(ffmt FileFormat) string {
+	if dffmt, ok := ffmt.(DescribedFileFormat); ok {
+		return dffmt.Descriptor()
+	}
+	return fmt.Sprintf("%T", ffmt)
+}
+
+// ParseFileFormat returns the file format corresponding to the given descriptor.
+// Options can be omitted, in which case the defaults are used (ex: "binary", "binary v2", "text", "text escaped" or "jsonl").
+func ParseFileFormat(descriptor string) (FileFormat, error) {
+	name, options, _ := strings.Cut(descriptor, " ")
+	switch name {
+	default:
+		return nil, fmt.Errorf("unknown file format %q", descriptor)
+	case "binary":
+		switch options {
+		default:
+			return nil, fmt.Errorf("unknown byte order %q", options)
+		case "v2":
+			return BinaryFileFormatV2{}, nil
+		case "", binary.BigEndian.String():
+			return BinaryFileFormat{ByteOrder: binary.BigEndian}, nil
+		case binary.LittleEndian.String():
+			return BinaryFileFormat{ByteOrder: binary.LittleEndian}, nil
+		}
+	case "aes-gcm":
+		return nil, fmt.Errorf("encrypted file format %q requires keys (see NewEncryptedFileFormat)", descriptor)
+	case "jsonl":
+		return JSONLinesFileFormat{}, nil
+	case "text":
+		switch options {
+		case "":
+			return DefaultTextFileFormat, nil
+		case "escaped":
+			return DefaultEscapedTextFileFormat, nil
+		}
+		fields := strings.Fields(options)
+		tff := TextFileFormat{}
+		if len(fields) == 7 && fields[6] == "escaped" {
+			tff.Escaped, fields = true, fields[:6]
+		}
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("invalid text format options %q", options)
+		}
+		var err error
+		tff.Base, err = strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("parse base: %w", err)
+		}
+		suffixes := []*byte{&tff.CharSuffixOp, &tff.CharSuffixGroupID, &tff.CharSuffixTimestamp, &tff.CharSuffixKey, &tff.CharSuffixValue}
+		for i, suffix := range suffixes {
+			c, err := strconv.ParseUint(fields[i+1], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("parse suffix %d: %w", i, err)
+			}
+			*suffix = byte(c)
+		}
+		return tff, nil
+	}
+}
+
+func encodeHeader(ffmt FileFormat) []byte {
+	return []byte(headerMagic + strconv.Itoa(HeaderVersion) + " " + describeFileFormat(ffmt) + "\n")
+}
+
+// readHeader reads the file header.
+// If the file has no header, nothing is consumed and a zero version and empty descriptor are returned.
+// If the file ends before the end of the header (ex: after a crash during the file creation),
+// an error wrapping io.ErrUnexpectedEOF is returned.
+func readHeader(r *bufio.Reader) (version int, descriptor string, n int64, err error) {
+	magic, err := r.Peek(len(headerMagic))
+	if err != nil && len(magic) > 0 && strings.HasPrefix(headerMagic, string(magic)) {
+		return 0, "", 0, fmt.Errorf("read header: %w", io.ErrUnexpectedEOF) // no line op starts like the magic
+	}
+	if err != nil || string(magic) != headerMagic {
+		return 0, "", 0, nil // empty or legacy file
+	}
+	line, err := r.ReadString('\n')
+	n = int64(len(line))
+	if err != nil {
+		return 0, "", n, fmt.Errorf("read header: %w", eofIsUnexpected(err))
+	}
+	versionStr, descriptor, _ := strings.Cut(strings.TrimPrefix(line[:len(line)-1], headerMagic), " ")
+	version, err = strconv.Atoi(versionStr)
+	if err != nil {
+		return 0, "", n, fmt.Errorf("parse header version: %w", err)
+	}
+	if version > HeaderVersion {
+		return 0, "", n, fmt.Errorf("unsupported header version %d (latest supported is %d)", version, HeaderVersion)
+	}
+	return version, descriptor, n, nil
+}
+
+// resolveFileFormat returns the file format to use for a file with the given header descriptor.
+// If ffmt is nil, the format is detected from the descriptor.
+// Otherwise, an error is returned if the descriptor doesn't match the given format.
+func resolveFileFormat(ffmt FileFormat, descriptor string) (FileFormat, error) {
+	switch {
+	case descriptor == "" && ffmt == nil:
+		return DefaultTextFileFormat, nil // legacy file
+	case descriptor == "":
+		return ffmt, nil
+	case ffmt == nil:
+		detected, err := ParseFileFormat(descriptor)
+		if err != nil {
+			return nil, fmt.Errorf("detect file format: %w", err)
+		}
+		return detected, nil
+	}
+	if expected := describeFileFormat(ffmt); expected != descriptor {
+		return nil, fmt.Errorf("%w: file was written with %q, not %q", ErrFormatMismatch, descriptor, expected)
+	}
+	return ffmt, nil
+}
@@ -0,0 +1,123 @@
+package jiffy
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+)
+
+// IndexFunc returns the index keys of a key-value pair (ex: the email address of a user).
+type IndexFunc func(key, value []byte) [][]byte
+
+// Index registers a secondary index on a group.
+// The index is rebuilt when the file is opened and kept up to date as transactions are committed,
+// it can be queried with GroupReader.Index.
+func Index(gid GroupID, name string, extract IndexFunc) Option {
+	return func(f *File) {
+		f.indexDefs = append(f.indexDefs, indexDef{gid: gid, name: name, extract: extract})
+	}
+}
+
+type indexDef struct {
+	gid     GroupID
+	name    string
+	extract IndexFunc
+}
+
+// initIndexes attaches the registered indexes to the memindexes of their groups.
+func (f *File) initIndexes() error {
+	for _, def := range f.indexDefs {
+		gmidx := f.memidxs[def.gid]
+		if gmidx == nil {
+			return fmt.Errorf("index %q: %w: %d", def.name, ErrGroupNotFound, def.gid)
+		}
+		if gmidx.indexes == nil {
+			gmidx.indexes = map[string]*secondaryIndex{}
+		}
+		if _, ok := gmidx.indexes[def.name]; ok {
+			return fmt.Errorf("index %q is registered twice for group %d", def.name, def.gid)
+		}
+		gmidx.indexes[def.name] = newSecondaryIndex(def.extract)
+	}
+	return nil
+}
+
+// secondaryIndex maps index keys to the keys of a group.
+type secondaryIndex struct {
+	extract   IndexFunc
+	keys      map[string]map[string]struct{} // index key -> keys
+	indexKeys map[string][]string            // key -> index keys (to remove outdated entries)
+}
+
+func newSecondaryIndex(extract IndexFunc) *secondaryIndex {
+	return &secondaryIndex{extract: extract, keys: map[string]map[string]struct{}{}, indexKeys: map[string][]string{}}
+}
+
+// put replaces the index keys of a key.
+func (idx *secondaryIndex) put(key, value []byte) {
+	idx.remove(key)
+	var indexKeys []string
+	for _, ik := range idx.extract(key, value) {
+		indexKey := string(ik)
+		if slices.Contains(indexKeys, indexKey) {
+			continue
+		}
+		indexKeys = append(indexKeys, indexKey)
+		if idx.keys[indexKey] == nil {
+			idx.keys[indexKey] = map[string]struct{}{}
+		}
+		idx.keys[indexKey][string(key)] = struct{}{}
+	}
+	if len(indexKeys) > 0 {
+		idx.indexKeys[string(key)] = indexKeys
+	}
+}
+
+// remove removes the index keys of a key.
+func (idx *secondaryIndex) remove(key []byte) {
+	for _, indexKey := range idx.indexKeys[string(key)] {
+		delete(idx.keys[indexKey], string(key))
+		if len(idx.keys[indexKey]) == 0 {
+			delete(idx.keys, indexKey)
+		}
+	}
+	delete(idx.indexKeys, string(key))
+}
+
+func (idx *secondaryIndex) clear() {
+	clear(idx.keys)
+	clear(idx.indexKeys)
+}
+
+// IndexReader queries a secondary index (see Index).
+type IndexReader struct {
+	g   *GroupReader
+	idx *secondaryIndex
+}
+
+// Index returns the index with the given name, or nil if no such index was registered for the group.
+func (g *GroupReader) Index(name string) *IndexReader {
+	idx := g.midx.indexes[name]
+	if idx == nil {
+		return nil
+	}
+	return &IndexReader{g: g, idx: idx}
+}
+
+// Seek returns cursors pointing to the keys with the given index key, in lexicographical order.
+// If no key matches, a nil value is returned.
+func (ir *IndexReader) Seek(indexKey []byte) []*Cursor {
+	keys := ir.idx.keys[string(indexKey)]
+	if len(keys) == 0 {
+		return nil
+	}
+	cursors := make([]*Cursor, 0, len(keys))
+	for key := range keys {
+		cursors = append(cursors, ir.g.Seek([]byte(key)))
+	}
+	slices.SortFunc(cursors, func(a, b *Cursor) int { return bytes.Compare(a.Key(), b.Key()) })
+	return cursors
+}
+
+// Count returns the number of keys with the given index key.
+func (ir *IndexReader) Count(indexKey []byte) int { return len(ir.idx.keys[string(indexKey)]) }
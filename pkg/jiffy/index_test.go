@@ -0,0 +1,82 @@
+package jiffy
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// tagsIndex indexes the comma-separated tags stored in values.
+func tagsIndex(key, value []byte) [][]byte { return bytes.Split(value, []byte(",")) }
+
+func TestIndex(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "db")
+	f := openTestFile(t, fpath, Index('k', "tags", tagsIndex))
+	putTestValues(t, f, "a", "x,y", "b", "y", "c", "y")
+	assertIndexKeys(t, f, "y", "a", "b", "c")
+
+	// Updates replace the index keys of the key
+	putTestValues(t, f, "a", "z")
+	assertIndexKeys(t, f, "x")
+	assertIndexKeys(t, f, "z", "a")
+
+	// Deletions remove the index keys
+	err := f.ReadWrite(func(r *Reader, w *Writer) error {
+		w.In('k').Delete([]byte("b"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIndexKeys(t, f, "y", "c")
+
+	// Indexes are rebuilt when reopening
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f = openTestFile(t, fpath, Index('k', "tags", tagsIndex))
+	assertIndexKeys(t, f, "y", "c")
+	assertIndexKeys(t, f, "z", "a")
+
+	// Clearing the group clears the index
+	err = f.ReadWrite(func(r *Reader, w *Writer) error {
+		w.In('k').Clear()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIndexKeys(t, f, "y")
+	assertIndexKeys(t, f, "z")
+}
+
+func TestIndexGroupNotFound(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "db"), nil, testGroups, Index('x', "tags", tagsIndex))
+	if !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("got %v, want %v", err, ErrGroupNotFound)
+	}
+}
+
+func assertIndexKeys(t *testing.T, f *File, indexKey string, want ...string) {
+	t.Helper()
+	var got []string
+	err := f.Read(func(r *Reader) error {
+		idx := r.In('k').Index("tags")
+		for _, c := range idx.Seek([]byte(indexKey)) {
+			got = append(got, string(c.Key()))
+		}
+		if n := idx.Count([]byte(indexKey)); n != len(want) {
+			t.Fatalf("index key %q: got count %d, want %d", indexKey, n, len(want))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("index key %q: got keys %q, want %q", indexKey, got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package jiffy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// JSONLinesFileFormat encodes each line as a JSON object followed by a newline.
+// Keys and values are stored as UTF-8 strings, or base64 strings if they are not valid UTF-8.
+type JSONLinesFileFormat struct{}
+
+type jsonLine struct {
+	Op          string    `json:"op"`
+	GroupID     GroupID   `json:"group"`
+	At          time.Time `json:"at"` // RFC3339 with nanoseconds
+	Key         *string   `json:"key,omitempty"`
+	KeyBase64   []byte    `json:"key_base64,omitempty"`
+	Value       *string   `json:"value,omitempty"`
+	ValueBase64 []byte    `json:"value_base64,omitempty"`
+}
+
+func (JSONLinesFileFormat) Descriptor() string { return "jsonl" }
+
+func (JSONLinesFileFormat) Encode(l Line) ([]byte, error) {
+	err := validateLengths(l.Key, l.Value, MaxLongKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	jl := jsonLine{Op: string(rune(l.Op)), GroupID: l.GroupID, At: l.At}
+	jl.Key, jl.KeyBase64 = jsonLineSlot(l.Key)
+	jl.Value, jl.ValueBase64 = jsonLineSlot(l.Value)
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(jl) // + newline
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func jsonLineSlot(b []byte) (*string, []byte) {
+	switch {
+	case len(b) == 0:
+		return nil, nil
+	case utf8.Valid(b):
+		s := string(b)
+		return &s, nil
+	default:
+		return nil, b
+	}
+}
+
+func (JSONLinesFileFormat) Decode(r *bufio.Reader) (int64, Line, error) {
+	l := Line{}
+	b, err := r.ReadBytes('\n')
+	read := int64(len(b))
+	if err != nil {
+		return read, l, fmt.Errorf("read line: %w", err)
+	}
+	jl := jsonLine{}
+	err = json.Unmarshal(b, &jl)
+	if err != nil {
+		return read, l, fmt.Errorf("decode JSON: %w", err)
+	}
+	if len(jl.Op) != 1 {
+		return read, l, fmt.Errorf("invalid op %q", jl.Op)
+	}
+	l.Op, l.GroupID, l.At = Opcode(jl.Op[0]), jl.GroupID, jl.At
+	switch {
+	case jl.Key != nil:
+		l.Key = []byte(*jl.Key)
+	case len(jl.KeyBase64) > 0:
+		l.Key = jl.KeyBase64
+	}
+	switch {
+	case jl.Value != nil:
+		l.Value = []byte(*jl.Value)
+	case len(jl.ValueBase64) > 0:
+		l.Value = jl.ValueBase64
+	}
+	return read, l, nil
+}
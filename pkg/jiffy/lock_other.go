@@ -0,0 +1,8 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package jiffy
+
+import "os"
+
+// lockFile is a no-op on platforms without flock support.
+func lockFile(fd *os.File) error { return nil }
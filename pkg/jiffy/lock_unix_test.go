@@ -0,0 +1,37 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package jiffy
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockKeepsOutWriters(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "db")
+	writer := openTestFile(t, fpath)
+	putTestValues(t, writer, "a", "1")
+
+	_, err := Open(fpath, nil, testGroups)
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("second writer: got %v, want %v", err, ErrLocked)
+	}
+
+	// Readers don't conflict with the writer
+	reader := openTestFile(t, fpath, ReadOnly())
+	assertTestValues(t, reader, map[string]string{"a": "1"})
+	err = Convert(fpath, nil, filepath.Join(dir, "converted"), JSONLinesFileFormat{})
+	if err != nil {
+		t.Fatalf("convert a file opened by a writer: %v", err)
+	}
+	putTestValues(t, writer, "b", "2") // still writable
+
+	// The lock is released on close
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	openTestFile(t, fpath)
+}
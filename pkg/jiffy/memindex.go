@@ -9,6 +9,7 @@ type memindex struct {
 	count          int        // number of unique non-deleted keys
 	oldest, latest *keyInfo   // links to oldest and latest items in chronological order
 	buckets        []*keyInfo // number of hashtable buckets (for separate chaining)
+	indexes        map[string]*secondaryIndex
 }
 
 type keyInfo struct {
@@ -19,8 +20,9 @@ type keyInfo struct {
 }
 
 type keyInfoLine struct {
-	p  Position
-	at time.Time
+	p      Position
+	at     time.Time
+	commit Position // position of the transaction's commit line
 }
 
 type Position [2]int64
@@ -36,17 +38,19 @@ func newMemindex(numBuckets int) *memindex {
 	return &memindex{buckets: make([]*keyInfo, numBuckets)}
 }
 
-func (lht *memindex) put(key []byte, at time.Time, p Position) {
+func (lht *memindex) put(key []byte, at time.Time, p, commit Position) {
 	bucketIndex := lht.hashFNV1a(key)
 	root := lht.buckets[bucketIndex]
 	var prevInBucket *keyInfo
 	for item := root; item != nil; prevInBucket, item = item, item.nextInBucket {
 		if bytes.Equal(item.key, key) {
 			// Append put position and move exisiting item to end of linked-list
-			item.puts = append(item.puts, keyInfoLine{at: at, p: p})
+			item.puts = append(item.puts, keyInfoLine{at: at, p: p, commit: commit})
 			if item != lht.latest {
 				if item == lht.oldest {
 					lht.oldest = item.next
+				} else {
+					item.previous.next = item.next
 				}
 				item.next.previous, item.next = item.previous, nil
 				item.previous, lht.latest.next = lht.latest, item // link to previous item
@@ -58,7 +62,7 @@ func (lht *memindex) put(key []byte, at time.Time, p Position) {
 
 	// Add new item to bucket and increment count
 	lht.count++
-	newItem := &keyInfo{key: key, puts: []keyInfoLine{{at: at, p: p}}}
+	newItem := &keyInfo{key: key, puts: []keyInfoLine{{at: at, p: p, commit: commit}}}
 	if prevInBucket == nil {
 		lht.buckets[bucketIndex] = newItem
 	} else {
@@ -80,9 +84,14 @@ func (lht *memindex) delete(key []byte) {
 	var prevInBucket *keyInfo
 	for item := root; item != nil; prevInBucket, item = item, item.nextInBucket {
 		if bytes.Equal(item.key, key) {
-			// Remove from bucket and decrement count
+			// Remove from bucket and indexes and decrement count
 			lht.count--
-			if prevInBucket != nil {
+			for _, idx := range lht.indexes {
+				idx.remove(key)
+			}
+			if prevInBucket == nil {
+				lht.buckets[bucketIndex] = item.nextInBucket
+			} else {
 				prevInBucket.nextInBucket = item.nextInBucket
 			}
 
@@ -102,6 +111,31 @@ func (lht *memindex) delete(key []byte) {
 	}
 }
 
+// deleteMatching deletes the keys for which match returns true.
+func (lht *memindex) deleteMatching(match func(key []byte) bool) {
+	for item := lht.oldest; item != nil; {
+		next := item.next // saved before the item is unlinked
+		if match(item.key) {
+			lht.delete(item.key)
+		}
+		item = next
+	}
+}
+
+// clear deletes all keys.
+func (lht *memindex) clear() {
+	clear(lht.buckets)
+	lht.count, lht.oldest, lht.latest = 0, nil, nil
+	for _, idx := range lht.indexes {
+		idx.clear()
+	}
+}
+
+// keyInRange reports whether start <= key < end in lexicographical order (an empty end is unbounded).
+func keyInRange(key, start, end []byte) bool {
+	return bytes.Compare(key, start) >= 0 && (len(end) == 0 || bytes.Compare(key, end) < 0)
+}
+
 func (lht *memindex) get(key []byte) *keyInfo {
 	root := lht.buckets[lht.hashFNV1a(key)]
 	for item := root; item != nil; item = item.nextInBucket {
@@ -0,0 +1,57 @@
+package jiffy
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMemindexPutMovesMiddleKey(t *testing.T) {
+	lht := newMemindex(8)
+	for _, key := range []string{"a", "b", "c"} {
+		lht.put([]byte(key), time.Now(), Position{}, Position{})
+	}
+	lht.put([]byte("b"), time.Now(), Position{}, Position{})
+	assertMemindexOrder(t, lht, "a", "c", "b")
+	if got := len(lht.get([]byte("b")).puts); got != 2 {
+		t.Fatalf("got %d puts for key %q, want 2", got, "b")
+	}
+}
+
+func TestMemindexDeleteBucketHead(t *testing.T) {
+	lht := newMemindex(1) // all keys share the same bucket
+	for _, key := range []string{"a", "b", "c"} {
+		lht.put([]byte(key), time.Now(), Position{}, Position{})
+	}
+	lht.delete([]byte("a"))
+	if lht.get([]byte("a")) != nil {
+		t.Fatalf("deleted key %q is still in its bucket", "a")
+	}
+	assertMemindexOrder(t, lht, "b", "c")
+
+	// Put the key again, it must be added once as a new key
+	lht.put([]byte("a"), time.Now(), Position{}, Position{})
+	assertMemindexOrder(t, lht, "b", "c", "a")
+	if got := len(lht.get([]byte("a")).puts); got != 1 {
+		t.Fatalf("got %d puts for key %q, want 1", got, "a")
+	}
+}
+
+// assertMemindexOrder checks the count and chronological order of keys, in both directions.
+func assertMemindexOrder(t *testing.T, lht *memindex, want ...string) {
+	t.Helper()
+	if lht.count != len(want) {
+		t.Fatalf("got count %d, want %d", lht.count, len(want))
+	}
+	var forward, backward []string
+	for item := lht.oldest; item != nil && len(forward) <= len(want); item = item.next {
+		forward = append(forward, string(item.key))
+	}
+	for item := lht.latest; item != nil && len(backward) <= len(want); item = item.previous {
+		backward = append(backward, string(item.key))
+	}
+	slices.Reverse(backward)
+	if !slices.Equal(forward, want) || !slices.Equal(backward, want) {
+		t.Fatalf("got keys %q from oldest and %q from latest, want %q", forward, backward, want)
+	}
+}
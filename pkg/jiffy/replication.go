@@ -0,0 +1,337 @@
+package jiffy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"time"
+)
+
+// Replication protocol:
+//
+//   - The follower sends a handshake: magic + its file size (uint64) + checksum of its file tail (uint32)
+//   - checksum of its file header (uint32).
+//   - The leader replies with a status byte, followed (if OK) by a stream of frames.
+//   - Each frame is a length (uint64) followed by raw encoded lines ending with a commit line.
+const (
+	replicationMagic                = "JFR2"
+	replicationHandshakeLen         = len(replicationMagic) + 8 + 4 + 4
+	replicationStatusOK             = byte(0)
+	replicationStatusDiverged       = byte(1)
+	replicationStatusFormatMismatch = byte(2)
+	replicationMinBackoff           = 100 * time.Millisecond
+	replicationMaxBackoff           = 10 * time.Second
+	replicationHandshakeTimeout     = 10 * time.Second
+)
+
+var ErrDiverged = errors.New("follower and leader logs have diverged")
+
+// errApplyFrame marks errors applying the leader's transactions, retrying would fetch the same transactions.
+var errApplyFrame = errors.New("apply frame")
+
+// ServeReplication accepts followers on the given listener and streams committed transactions to them.
+// It returns when the listener is closed.
+func (f *File) ServeReplication(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return fmt.Errorf("accept follower: %w", err)
+		}
+		go func() {
+			defer conn.Close()
+			_ = f.serveFollower(conn)
+		}()
+	}
+}
+
+func (f *File) serveFollower(conn net.Conn) error {
+	// Read handshake and check that the follower's log is a prefix of ours
+	handshake := [replicationHandshakeLen]byte{}
+	err := conn.SetReadDeadline(time.Now().Add(replicationHandshakeTimeout))
+	if err != nil {
+		return fmt.Errorf("set handshake deadline: %w", err)
+	}
+	_, err = io.ReadFull(conn, handshake[:])
+	if err != nil {
+		return fmt.Errorf("read handshake: %w", err)
+	}
+	err = conn.SetReadDeadline(time.Time{}) // the connection stays idle between frames
+	if err != nil {
+		return fmt.Errorf("clear handshake deadline: %w", err)
+	}
+	if string(handshake[:len(replicationMagic)]) != replicationMagic {
+		return errors.New("invalid handshake")
+	}
+	offset := int64(binary.BigEndian.Uint64(handshake[len(replicationMagic):]))
+	checksum := binary.BigEndian.Uint32(handshake[len(replicationMagic)+8:])
+	followerHeaderChecksum := binary.BigEndian.Uint32(handshake[len(replicationMagic)+12:])
+	f.mu.RLock()
+	size, err := f.fsize, f.checkOpen()
+	f.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	headerChecksum, err := f.headerChecksum()
+	if err != nil {
+		return err
+	}
+	if headerChecksum != followerHeaderChecksum {
+		_, _ = conn.Write([]byte{replicationStatusFormatMismatch})
+		return fmt.Errorf("%w: follower file header differs", ErrFormatMismatch)
+	}
+	if offset > size {
+		_, _ = conn.Write([]byte{replicationStatusDiverged})
+		return fmt.Errorf("%w: follower offset %d is past end of file (%d)", ErrDiverged, offset, size)
+	}
+	localChecksum, err := tailChecksum(f.r, offset)
+	if err != nil {
+		return err
+	}
+	if localChecksum != checksum {
+		_, _ = conn.Write([]byte{replicationStatusDiverged})
+		return fmt.Errorf("%w: checksum mismatch at offset %d", ErrDiverged, offset)
+	}
+	_, err = conn.Write([]byte{replicationStatusOK})
+	if err != nil {
+		return fmt.Errorf("write status: %w", err)
+	}
+
+	// Detect disconnection (the follower never sends anything after the handshake)
+	disconnected := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		close(disconnected)
+	}()
+
+	// Stream committed transactions
+	for {
+		f.mu.RLock()
+		size, commitc, err := f.fsize, f.commitc, f.checkOpen()
+		f.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		if size < offset {
+			return fmt.Errorf("%w: file was truncated to %d", ErrDiverged, size)
+		}
+		if size == offset {
+			select {
+			case <-commitc:
+				continue
+			case <-disconnected:
+				return nil
+			}
+		}
+		frameHeader := [8]byte{}
+		binary.BigEndian.PutUint64(frameHeader[:], uint64(size-offset))
+		_, err = conn.Write(frameHeader[:])
+		if err != nil {
+			return fmt.Errorf("write frame header: %w", err)
+		}
+		_, err = io.Copy(conn, io.NewSectionReader(f.r, offset, size-offset))
+		if err != nil {
+			return fmt.Errorf("write frame: %w", wrapClosed(err))
+		}
+		offset = size
+	}
+}
+
+// headerChecksum computes the checksum of the file header (the files' formats match if their header checksums match).
+func (f *File) headerChecksum() (uint32, error) {
+	buf := make([]byte, f.headerLength)
+	_, err := f.r.ReadAt(buf, 0)
+	if err != nil {
+		return 0, fmt.Errorf("read header: %w", wrapClosed(err))
+	}
+	return crc32.ChecksumIEEE(buf), nil
+}
+
+// tailChecksumWindow is the number of bytes preceding an offset used to compare two files.
+const tailChecksumWindow = 4096
+
+// tailChecksum computes the checksum of the bytes preceding the given offset.
+// Two append-only files are assumed to share the same prefix if their tail checksums match.
+func tailChecksum(r io.ReaderAt, offset int64) (uint32, error) {
+	start := offset - tailChecksumWindow
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, offset-start)
+	_, err := r.ReadAt(buf, start)
+	if err != nil {
+		return 0, fmt.Errorf("read tail at offset %d: %w", start, err)
+	}
+	return crc32.ChecksumIEEE(buf), nil
+}
+
+// Follow connects to the leader at the given address and appends its committed transactions
+// to the file until the context is done.
+// The follower resumes from its current file size after a disconnection.
+// While following, read-write transactions return ErrReadOnly.
+// If the logs have diverged (for example after the leader's file was rewritten), ErrDiverged is returned.
+// If the leader's file has another format or header version, ErrFormatMismatch is returned.
+// Errors applying the leader's transactions (ex: ErrGroupNotFound if the leader writes to a group
+// the follower didn't declare) are returned as well, since retrying would fetch the same transactions.
+func (f *File) Follow(ctx context.Context, addr string) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	f.mu.Lock()
+	if err := f.checkOpen(); err != nil {
+		f.mu.Unlock()
+		return err
+	}
+	if f.following {
+		f.mu.Unlock()
+		return errors.New("already following a leader")
+	}
+	f.following = true
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.following = false
+		f.mu.Unlock()
+	}()
+
+	backoff := replicationMinBackoff
+	for {
+		connected, err := f.followOnce(ctx, addr)
+		if errors.Is(err, ErrDiverged) || errors.Is(err, ErrFormatMismatch) || errors.Is(err, ErrClosed) || errors.Is(err, errApplyFrame) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			backoff = replicationMinBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > replicationMaxBackoff {
+			backoff = replicationMaxBackoff
+		}
+	}
+}
+
+// followOnce runs a single replication session and reports whether the handshake succeeded.
+func (f *File) followOnce(ctx context.Context, addr string) (bool, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return false, fmt.Errorf("dial leader: %w", err)
+	}
+	defer conn.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close() // unblock reads
+		case <-stop:
+		}
+	}()
+
+	// Send handshake
+	f.mu.RLock()
+	offset, err := f.fsize, f.checkOpen()
+	f.mu.RUnlock()
+	if err != nil {
+		return false, err
+	}
+	checksum, err := tailChecksum(f.r, offset)
+	if err != nil {
+		return false, err
+	}
+	headerChecksum, err := f.headerChecksum()
+	if err != nil {
+		return false, err
+	}
+	handshake := [replicationHandshakeLen]byte{}
+	copy(handshake[:], replicationMagic)
+	binary.BigEndian.PutUint64(handshake[len(replicationMagic):], uint64(offset))
+	binary.BigEndian.PutUint32(handshake[len(replicationMagic)+8:], checksum)
+	binary.BigEndian.PutUint32(handshake[len(replicationMagic)+12:], headerChecksum)
+	_, err = conn.Write(handshake[:])
+	if err != nil {
+		return false, fmt.Errorf("write handshake: %w", err)
+	}
+	status := [1]byte{}
+	_, err = io.ReadFull(conn, status[:])
+	if err != nil {
+		return false, fmt.Errorf("read status: %w", err)
+	}
+	switch status[0] {
+	case replicationStatusDiverged:
+		return false, fmt.Errorf("%w: at offset %d", ErrDiverged, offset)
+	case replicationStatusFormatMismatch:
+		return false, fmt.Errorf("%w: leader file has another format or header version", ErrFormatMismatch)
+	}
+
+	// Apply frames
+	bufr := bufio.NewReader(conn)
+	for {
+		frameHeader := [8]byte{}
+		_, err = io.ReadFull(bufr, frameHeader[:])
+		if err != nil {
+			return true, fmt.Errorf("read frame header: %w", err)
+		}
+		err = f.appendCommitted(bufr, int64(binary.BigEndian.Uint64(frameHeader[:])))
+		if err != nil {
+			return true, err
+		}
+	}
+}
+
+// appendCommitted appends raw encoded transactions to the file and applies them to the memstate.
+// Only the follower writes to the file, so the bytes are written before taking the lock.
+// Readers never access bytes past the file size.
+func (f *File) appendCommitted(r io.Reader, n int64) error {
+	f.mu.RLock()
+	start, err := f.fsize, f.checkOpen()
+	f.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// Write and persist frame
+	written, err := io.CopyN(f.w, r, n)
+	if err == nil {
+		err = f.w.Sync()
+	}
+	if err != nil {
+		f.mu.Lock()
+		if written > 0 && !f.closed {
+			f.mustTruncateTailCorruption(start)
+		}
+		f.mu.Unlock()
+		return fmt.Errorf("append frame: %w", wrapClosed(err))
+	}
+
+	// Apply frame to memstate
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkOpen(); err != nil {
+		return err // the frame is replayed when the file is reopened
+	}
+	committed, read, err := f.replay(bufio.NewReader(io.NewSectionReader(f.r, start, n)), start)
+	if err == nil && (committed != start+n || read != start+n) {
+		err = fmt.Errorf("frame ends with uncommitted data at offset %d", committed)
+	}
+	if err != nil {
+		f.mustTruncateTailCorruption(committed)
+		f.notifyCommit()
+		return fmt.Errorf("%w: %w", errApplyFrame, err)
+	}
+	f.fsize = committed
+	f.notifyCommit()
+	return nil
+}
@@ -0,0 +1,181 @@
+package jiffy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var replicationTestGroups = map[GroupID]int{'k': 1}
+
+func TestReplication(t *testing.T) {
+	dir := t.TempDir()
+	leader := openReplicationTestFile(t, filepath.Join(dir, "leader"))
+	follower := openReplicationTestFile(t, filepath.Join(dir, "follower"))
+	addr := serveReplicationTest(t, leader)
+
+	// Stream transactions committed while following
+	stop := followReplicationTest(t, follower, addr)
+	putReplicationTest(t, leader, "a", "b")
+	waitForReplicatedKeys(t, follower, 2)
+	err := follower.ReadWrite(func(r *Reader, w *Writer) error { return nil })
+	if !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("read-write transaction on a follower: got %v, want %v", err, ErrReadOnly)
+	}
+	stop()
+
+	// Resume from the follower's file size after a disconnection
+	putReplicationTest(t, leader, "c")
+	stop = followReplicationTest(t, follower, addr)
+	waitForReplicatedKeys(t, follower, 3)
+	stop()
+
+	leaderBytes, err := os.ReadFile(leader.fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	followerBytes, err := os.ReadFile(follower.fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(leaderBytes, followerBytes) {
+		t.Fatalf("follower file differs from leader file:\n%q\n%q", followerBytes, leaderBytes)
+	}
+}
+
+func TestReplicationDiverged(t *testing.T) {
+	dir := t.TempDir()
+	leader := openReplicationTestFile(t, filepath.Join(dir, "leader"))
+	follower := openReplicationTestFile(t, filepath.Join(dir, "follower"))
+	putReplicationTest(t, leader, "a")
+	putReplicationTest(t, follower, "b") // written locally, not by the leader
+	addr := serveReplicationTest(t, leader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := follower.Follow(ctx, addr)
+	if !errors.Is(err, ErrDiverged) {
+		t.Fatalf("got %v, want %v", err, ErrDiverged)
+	}
+}
+
+// Transactions that can't be applied are not fetched again.
+func TestReplicationApplyError(t *testing.T) {
+	dir := t.TempDir()
+	leader, err := Open(filepath.Join(dir, "leader"), nil, map[GroupID]int{'k': 1, 'x': 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = leader.Close() })
+	follower := openReplicationTestFile(t, filepath.Join(dir, "follower"))
+	err = leader.ReadWrite(func(r *Reader, w *Writer) error {
+		w.In('x').Put([]byte("a"), []byte("in a group the follower didn't declare"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveReplicationTest(t, leader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = follower.Follow(ctx, addr)
+	if !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("got %v, want %v", err, ErrGroupNotFound)
+	}
+}
+
+func TestReplicationFormatMismatch(t *testing.T) {
+	dir := t.TempDir()
+	leader := openReplicationTestFile(t, filepath.Join(dir, "leader"))
+	follower, err := Open(filepath.Join(dir, "follower"), BinaryFileFormatV2{}, replicationTestGroups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = follower.Close() })
+	addr := serveReplicationTest(t, leader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = follower.Follow(ctx, addr)
+	if !errors.Is(err, ErrFormatMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrFormatMismatch)
+	}
+}
+
+func openReplicationTestFile(t *testing.T, fpath string) *File {
+	t.Helper()
+	f, err := Open(fpath, nil, replicationTestGroups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+// serveReplicationTest serves replication on a loopback address until the end of the test.
+func serveReplicationTest(t *testing.T, leader *File) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() { _ = leader.ServeReplication(ln) }()
+	return ln.Addr().String()
+}
+
+// followReplicationTest follows the leader in the background, the returned function stops following.
+func followReplicationTest(t *testing.T, follower *File, addr string) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- follower.Follow(ctx, addr) }()
+	return func() {
+		t.Helper()
+		cancel()
+		if err := <-errc; !errors.Is(err, context.Canceled) {
+			t.Fatalf("follow: %v", err)
+		}
+	}
+}
+
+func putReplicationTest(t *testing.T, f *File, keys ...string) {
+	t.Helper()
+	err := f.ReadWrite(func(r *Reader, w *Writer) error {
+		for _, key := range keys {
+			w.In('k').Put([]byte(key), []byte("value of "+key))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitForReplicatedKeys(t *testing.T, follower *File, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := 0
+		err := follower.Read(func(r *Reader) error {
+			got = r.In('k').Count()
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("follower has %d keys after 5s, want %d", got, count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
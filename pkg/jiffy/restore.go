@@ -0,0 +1,172 @@
+package jiffy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// restoreNumBuckets is the number of hashtable buckets of the groups replayed by RestoreAsOf.
+const restoreNumBuckets = 1024
+
+// RestoreAsOf writes a new file at dst containing the state of src as of the given time.
+// The source file is replayed up to the last commit whose timestamp is before or equal to t,
+// and the key-value pairs that exist at that point are written to dst in a single transaction
+// (overwritten and deleted values are not copied). Keys keep their chronological order and timestamps.
+// If ffmt is nil, the file format is detected from the file header, dst is written with the same format.
+func RestoreAsOf(src, dst string, ffmt FileFormat, t time.Time) error {
+	s, err := openLineScanner(src, ffmt)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	memidxs, lastTx, err := replayAsOf(s, t)
+	if err != nil {
+		return err
+	}
+	if lastTx == nil {
+		return fmt.Errorf("no transaction committed before %s", t.Format(time.RFC3339))
+	}
+
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return fmt.Errorf("create destination file: %w", err)
+	}
+	err = writeRestoredState(w, s, memidxs, lastTx)
+	if err == nil {
+		err = w.Sync()
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("write restored state: %w", err)
+	}
+	return nil
+}
+
+// replayAsOf replays and verifies the transactions committed before or at t.
+// It returns the memstate of each group and the last replayed commit line (nil if there is none).
+func replayAsOf(s *lineScanner, t time.Time) ([256]*memindex, *Line, error) {
+	memidxs := [256]*memindex{}
+	var lastTx *Line
+	var txLines []txReplayLine
+	txv := &txVerifier{}
+	for {
+		p, l, err := s.next()
+		if errors.Is(err, io.EOF) {
+			return memidxs, lastTx, nil // uncommitted tail lines are ignored
+		}
+		if err != nil {
+			return memidxs, lastTx, err
+		}
+		switch l.Op {
+		default:
+			return memidxs, lastTx, fmt.Errorf("illegal op %q at offset %d", l.Op, p.Offset())
+		case OpBegin:
+			err = txv.begin(l, len(txLines))
+			if err != nil {
+				return memidxs, lastTx, fmt.Errorf("begin line at offset %d: %w", p.Offset(), err)
+			}
+		case OpDelete, OpDeleteRange, OpDeletePrefix, OpClear, OpPut, OpPutDeflated:
+			txv.add(l)
+			txLines = append(txLines, txReplayLine{p: p, l: l})
+		case OpCommit:
+			if l.At.After(t) {
+				return memidxs, lastTx, nil
+			}
+			_, err = txv.commit(l)
+			if err != nil {
+				return memidxs, lastTx, fmt.Errorf("commit line at offset %d: %w", p.Offset(), err)
+			}
+			for _, txLine := range txLines {
+				txLine.l.resolveAt(l.At)
+				gmidx := memidxs[txLine.l.GroupID]
+				if gmidx == nil {
+					gmidx = newMemindex(restoreNumBuckets)
+					memidxs[txLine.l.GroupID] = gmidx
+				}
+				switch txLine.l.Op {
+				case OpPut, OpPutDeflated:
+					gmidx.put(txLine.l.Key, txLine.l.At, txLine.p, p)
+				case OpDelete:
+					gmidx.delete(txLine.l.Key)
+				case OpDeleteRange:
+					gmidx.deleteMatching(func(key []byte) bool { return keyInRange(key, txLine.l.Key, txLine.l.Value) })
+				case OpDeletePrefix:
+					gmidx.deleteMatching(func(key []byte) bool { return bytes.HasPrefix(key, txLine.l.Key) })
+				case OpClear:
+					gmidx.clear()
+				}
+			}
+			txLines, lastTx = nil, &l
+		}
+	}
+}
+
+// writeRestoredState writes a file containing the current value of each key in a single transaction.
+// The transaction ID and commit timestamp are the ones of the last restored transaction.
+func writeRestoredState(w io.Writer, s *lineScanner, memidxs [256]*memindex, lastTx *Line) error {
+	txID := uint64(1) // for files written without envelope
+	if len(lastTx.Key) > 0 {
+		var err error
+		txID, err = parseTxID(lastTx.Key)
+		if err != nil {
+			return err
+		}
+	}
+	commitAt := lastTx.At
+	bufw := bufio.NewWriter(w)
+	write := func(l Line) error {
+		encoded, err := s.ffmt.Encode(l)
+		if err != nil {
+			return fmt.Errorf("encode line: %w", err)
+		}
+		_, err = bufw.Write(encoded)
+		return err
+	}
+	_, err := bufw.Write(encodeHeader(s.ffmt))
+	if err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	err = write(Line{Op: OpBegin, At: commitAt, GroupID: GroupID(OpBegin), Key: encodeTxID(txID)})
+	if err != nil {
+		return err
+	}
+	checksum := newTxChecksum()
+	for _, gmidx := range memidxs {
+		if gmidx == nil {
+			continue
+		}
+		for kinfo := gmidx.oldest; kinfo != nil; kinfo = kinfo.next {
+			latest := kinfo.puts[len(kinfo.puts)-1]
+			l, err := readLineAt(s.fd, s.ffmt, latest.p)
+			if err != nil {
+				return fmt.Errorf("read line at offset %d: %w", latest.p.Offset(), err)
+			}
+			l.At = latest.at
+			l.BeforeCommit = commitAt.Sub(l.At)
+			checksum.add(l)
+			err = write(l)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = write(Line{
+		Op:      OpCommit,
+		At:      commitAt,
+		GroupID: GroupID(OpCommit),
+		Key:     encodeTxID(txID),
+		Value:   encodeCommitValue(checksum.summary(), nil),
+	})
+	if err != nil {
+		return err
+	}
+	return bufw.Flush()
+}
@@ -0,0 +1,60 @@
+package jiffy
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRestoreAsOf(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	f := openTestFile(t, src)
+	putTestValues(t, f, "a", "1", "b", "1", "c", "1", "d", "1", "e", "1")
+	err := f.ReadWrite(func(r *Reader, w *Writer) error {
+		w.In('k').Put([]byte("a"), []byte("2")) // overwritten
+		w.In('k').Delete([]byte("b"))
+		w.In('k').DeleteRange([]byte("c"), []byte("e")) // deletes c and d
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	asOf := time.Now()
+	time.Sleep(time.Millisecond)
+	putTestValues(t, f, "a", "3", "f", "3") // committed after the restore time
+
+	err = RestoreAsOf(src, dst, nil, asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := openTestFile(t, dst)
+	assertTestValues(t, restored, map[string]string{"a": "2", "e": "1"})
+	err = restored.Read(func(r *Reader) error {
+		if n := r.In('k').Seek([]byte("a")).History().Length(); n != 1 {
+			t.Fatalf("got %d versions of the restored key, want 1", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The restored file continues from the last restored transaction
+	assertLastTxID(t, restored, 2)
+	putTestValues(t, restored, "g", "4")
+	assertLastTxID(t, restored, 3)
+}
+
+func TestRestoreAsOfBeforeFirstCommit(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	asOf := time.Now()
+	time.Sleep(time.Millisecond)
+	putTestValues(t, openTestFile(t, src), "a", "1")
+	err := RestoreAsOf(src, filepath.Join(dir, "dst"), nil, asOf)
+	if err == nil {
+		t.Fatal("got no error restoring a time before the first commit")
+	}
+}
@@ -3,29 +3,56 @@ package jiffy
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"slices"
 	"time"
 )
 
-type Reader struct{ f *File }
+type Reader struct {
+	f   *File
+	ctx context.Context
+}
 
 func (f *File) Read(do func(r *Reader) error) error {
-	f.mu.RLock()
+	return f.ReadCtx(context.Background(), do)
+}
+
+// ReadCtx is like Read, but gives up waiting for the lock when the context is done.
+// The callback can observe the context with Reader.Context.
+func (f *File) ReadCtx(ctx context.Context, do func(r *Reader) error) error {
+	err := lockCtx(ctx, f.mu.RLock, f.mu.RUnlock)
+	if err != nil {
+		return fmt.Errorf("acquire read lock: %w", err)
+	}
 	defer f.mu.RUnlock()
-	r := &Reader{f: f}
+	if err := f.checkOpen(); err != nil {
+		return err
+	}
+	r := &Reader{f: f, ctx: ctx}
 	return do(r)
 }
 
+// Context returns the context of the transaction.
+func (r *Reader) Context() context.Context { return r.ctx }
+
 func (r *Reader) Length() int64 { return r.f.fsize }
 
 func (r *Reader) Path() string { return r.f.fpath }
 
+// LastTxID returns the ID of the last committed transaction (zero if there is none).
+func (r *Reader) LastTxID() uint64 { return r.f.lastTxID }
+
 type GroupReader struct {
 	f    *File
 	gid  GroupID
 	midx *memindex
 }
 
+// In returns the group with the given ID, or nil if it wasn't declared when opening the file (see Group).
 func (r *Reader) In(gid GroupID) *GroupReader {
 	gmemidx := r.f.memidxs[gid]
 	if gmemidx == nil {
@@ -34,6 +61,24 @@ func (r *Reader) In(gid GroupID) *GroupReader {
 	return &GroupReader{f: r.f, gid: gid, midx: gmemidx}
 }
 
+// Group is like In, but returns ErrGroupNotFound if the group wasn't declared when opening the file.
+func (r *Reader) Group(gid GroupID) (*GroupReader, error) {
+	g := r.In(gid)
+	if g == nil {
+		return nil, fmt.Errorf("%w: %d", ErrGroupNotFound, gid)
+	}
+	return g, nil
+}
+
+// Get returns the current value of a key, or ErrKeyNotFound if the key doesn't exist.
+func (g *GroupReader) Get(key []byte) ([]byte, error) {
+	c := g.Seek(key)
+	if c == nil {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	}
+	return c.History().Value()
+}
+
 func (c *GroupReader) Count() int { return c.midx.count }
 
 // Cursor represents a pointer to a specific key within the linefile.
@@ -109,6 +154,7 @@ type Version struct {
 	f        *File
 	At       time.Time
 	Position Position
+	commit   Position
 }
 
 func (h *History) Version(i int) *Version {
@@ -116,63 +162,286 @@ func (h *History) Version(i int) *Version {
 		return nil
 	}
 	version := h.versions[i]
-	return &Version{f: h.f, At: version.at, Position: version.p}
+	return &Version{f: h.f, At: version.at, Position: version.p, commit: version.commit}
 }
 
 // Value reads the value for the current version.
 func (version *Version) Value() ([]byte, error) {
-	buf := make([]byte, version.Position.Length())
-	_, err := version.f.r.ReadAt(buf, version.Position.Offset())
+	if value, ok := version.f.cache.get(version.Position); ok {
+		return value, nil
+	}
+	l, err := version.f.readLine(version.Position)
+	if err != nil {
+		return nil, err
+	}
+	value, err := lineValue(l)
 	if err != nil {
 		return nil, err
 	}
-	_, l, err := version.f.ffmt.Decode(bufio.NewReader(bytes.NewReader(buf)))
+	version.f.cache.add(version.Position, value)
+	return value, nil
+}
+
+// readLine reads and decodes the line at the given position.
+func (f *File) readLine(p Position) (Line, error) {
+	l, err := readLineAt(f.r, f.ffmt, p)
+	return l, wrapClosed(err)
+}
+
+func readLineAt(r io.ReaderAt, ffmt FileFormat, p Position) (Line, error) {
+	buf := make([]byte, p.Length())
+	_, err := r.ReadAt(buf, p.Offset())
+	if err != nil {
+		return Line{}, err
+	}
+	_, l, err := ffmt.Decode(bufio.NewReader(bytes.NewReader(buf)))
+	if err != nil {
+		return Line{}, err
+	}
+	return l, nil
+}
+
+// Log calls the given function for each committed transaction in chronological order.
+// If the function returns an error, the iteration stops and the error is returned.
+func (r *Reader) Log(do func(tx *TxInfo) error) error {
+	bufr := bufio.NewReader(io.NewSectionReader(r.f.r, r.f.headerLength, r.f.fsize-r.f.headerLength))
+	offset := r.f.headerLength
+	for {
+		lineLength, l, err := r.f.ffmt.Decode(bufr)
+		offset += lineLength
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read row at offset %d: %w", offset-lineLength, err)
+		}
+		if l.Op != OpCommit {
+			continue
+		}
+		tx, err := parseTxInfo(l)
+		if err != nil {
+			return fmt.Errorf("parse commit line at offset %d: %w", offset-lineLength, err)
+		}
+		err = do(tx)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Tx reads the information about the transaction that wrote the current version.
+func (version *Version) Tx() (*TxInfo, error) {
+	l, err := version.f.readLine(version.commit)
 	if err != nil {
 		return nil, err
 	}
-	return l.Value, nil
+	return parseTxInfo(l)
 }
 
 // Value returns the last value in the history.
 func (h *History) Value() ([]byte, error) { return h.Version(h.Length() - 1).Value() }
 
 type Writer struct {
-	f     *File
-	lines []Line
+	f          *File
+	ctx        context.Context
+	lines      []Line
+	metadata   map[string]string
+	savepoints []uint64 // IDs of the savepoints that can be rolled back to
+	lastSpID   uint64
+}
+
+// Context returns the context of the transaction.
+func (w *Writer) Context() context.Context { return w.ctx }
+
+// Annotate attaches metadata to the transaction (ex: the service or request that produced it).
+// Metadata is stored in the commit line and can be retrieved with Version.Tx and Reader.Log.
+func (w *Writer) Annotate(key, value string) {
+	if w.metadata == nil {
+		w.metadata = map[string]string{}
+	}
+	w.metadata[key] = value
+}
+
+var ErrInvalidSavepoint = errors.New("invalid savepoint")
+
+// Savepoint marks a point in a transaction's writes (see Writer.RollbackTo).
+type Savepoint struct {
+	w     *Writer
+	id    uint64
+	lines int
+}
+
+// Savepoint returns a savepoint for the current state of the transaction's writes.
+func (w *Writer) Savepoint() Savepoint {
+	w.lastSpID++
+	w.savepoints = append(w.savepoints, w.lastSpID)
+	return Savepoint{w: w, id: w.lastSpID, lines: len(w.lines)}
+}
+
+// RollbackTo discards the writes made after the savepoint, the rest of the transaction is kept.
+// Metadata is not affected. Savepoints taken after sp are released, sp itself can be rolled back to again.
+func (w *Writer) RollbackTo(sp Savepoint) error {
+	if sp.w != w {
+		return fmt.Errorf("%w: savepoint belongs to another transaction", ErrInvalidSavepoint)
+	}
+	i := slices.Index(w.savepoints, sp.id)
+	if i == -1 {
+		return fmt.Errorf("%w: savepoint was released by a previous rollback", ErrInvalidSavepoint)
+	}
+	w.savepoints = w.savepoints[:i+1]
+	clear(w.lines[sp.lines:]) // release discarded keys and values
+	w.lines = w.lines[:sp.lines]
+	return nil
 }
 
 func (f *File) ReadWrite(do func(r *Reader, w *Writer) error) error {
-	f.mu.Lock()
-	defer f.mu.Unlock()
+	return f.ReadWriteCtx(context.Background(), do)
+}
+
+// ReadWriteCtx is like ReadWrite, but gives up waiting for the lock when the context is done.
+// The callback can observe the context with Reader.Context and Writer.Context.
+// If the context is done once the callback returns, the transaction is aborted before anything is written.
+func (f *File) ReadWriteCtx(ctx context.Context, do func(r *Reader, w *Writer) error) error {
+	tx, err := f.BeginCtx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }() // no-op once committed, releases the lock if the callback panics
 
 	// Execute callback, if the callback returns an error, the transaction is aborted.
-	r, w := &Reader{f: f}, &Writer{f: f}
-	err := do(r, w)
+	err = do(tx.r, tx.w)
 	if err != nil {
 		return fmt.Errorf("exec read-write transaction: %w", err)
 	}
+	return tx.Commit()
+}
+
+var ErrTxDone = errors.New("transaction already committed or rolled back")
+
+// Tx is a read-write transaction that spans several calls, ex: the commands of a REPL session.
+// It holds the file's write lock from Begin until Commit or Rollback,
+// meanwhile all other transactions (including read-only ones) wait, so a Tx must always be finished.
+// A Tx is not safe for concurrent use.
+type Tx struct {
+	f       *File
+	ctx     context.Context
+	r       *Reader
+	w       *Writer
+	beginAt time.Time
+	done    bool
+}
+
+// Begin starts a read-write transaction.
+func (f *File) Begin() (*Tx, error) { return f.BeginCtx(context.Background()) }
 
-	// Encode all lines in a temporary buffer
-	buf := []byte{}
+// BeginCtx is like Begin, but gives up waiting for the lock when the context is done.
+// If the context is done when committing, the transaction is aborted before anything is written.
+func (f *File) BeginCtx(ctx context.Context) (*Tx, error) {
+	if f.readOnly {
+		return nil, ErrReadOnly
+	}
+	err := lockCtx(ctx, f.mu.Lock, f.mu.Unlock)
+	if err != nil {
+		return nil, fmt.Errorf("acquire write lock: %w", err)
+	}
+	if err := f.checkOpen(); err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	if f.following {
+		f.mu.Unlock()
+		return nil, fmt.Errorf("%w: following a leader", ErrReadOnly)
+	}
+	return &Tx{
+		f:       f,
+		ctx:     ctx,
+		r:       &Reader{f: f, ctx: ctx},
+		w:       &Writer{f: f, ctx: ctx},
+		beginAt: time.Now(),
+	}, nil
+}
+
+// Reader returns the reader of the transaction, it sees the committed state (not the pending writes).
+func (tx *Tx) Reader() *Reader { return tx.r }
+
+// Writer returns the writer of the transaction.
+func (tx *Tx) Writer() *Writer { return tx.w }
+
+// Commit writes the pending lines to the file and releases the write lock.
+// The transaction is finished even if an error is returned.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	defer tx.f.mu.Unlock()
+	if err := tx.ctx.Err(); err != nil {
+		return fmt.Errorf("abort read-write transaction: %w", err)
+	}
+	return tx.f.commit(tx.w, tx.beginAt)
+}
+
+// Rollback discards the pending lines and releases the write lock.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.f.mu.Unlock()
+	return nil
+}
+
+// commit writes the lines of a transaction and applies them to the memstate.
+// It must be called with the write lock held.
+func (f *File) commit(w *Writer, beginAt time.Time) error {
+	// Encode all lines in a temporary buffer, starting with the begin line
+	txID, commitAt := f.lastTxID+1, time.Now()
+	beginLine := []Line{{Op: OpBegin, At: beginAt, GroupID: GroupID(OpBegin), Key: encodeTxID(txID)}}
+	setBeforeCommit(beginLine, commitAt)
+	setBeforeCommit(w.lines, commitAt)
+	buf, err := f.ffmt.Encode(beginLine[0])
+	if err != nil {
+		return err
+	}
+	checksum := newTxChecksum()
 	positions := make([]Position, 0, len(w.lines))
 	for _, l := range w.lines {
 		if f.memidxs[l.GroupID] == nil {
-			return fmt.Errorf("group with ID %d not found", l.GroupID)
+			return fmt.Errorf("%w: %d", ErrGroupNotFound, l.GroupID)
+		}
+		if f.headerVersion < 2 && len(l.Key) > MaxKeyLength {
+			return fmt.Errorf("%w (%d B / %d B) for header version %d", ErrKeyTooLong, len(l.Key), MaxKeyLength, f.headerVersion)
+		}
+		cl, err := f.compressLine(l)
+		if err != nil {
+			return err
+		}
+		encoded, err := f.ffmt.Encode(cl)
+		if err != nil && cl.Op == OpPutDeflated {
+			cl = l // the format can't store the compressed bytes (ex: unescaped text format), keep the value uncompressed
+			encoded, err = f.ffmt.Encode(cl)
 		}
-		bufOffset := len(buf)
-		encoded, err := f.ffmt.Encode(l)
 		if err != nil {
 			return err
 		}
+		checksum.add(cl)
+		bufOffset := len(buf)
 		positions = append(positions, NewPosition(int64(bufOffset), int64(len(encoded))))
 		buf = append(buf, encoded...)
 	}
 
 	// Append commit line to buffer
-	commitLine, err := f.ffmt.Encode(Line{Op: OpCommit, At: time.Now(), GroupID: GroupID(OpCommit)})
+	commitLine, err := f.ffmt.Encode(Line{
+		Op:      OpCommit,
+		At:      commitAt,
+		GroupID: GroupID(OpCommit),
+		Key:     encodeTxID(txID),
+		Value:   encodeCommitValue(checksum.summary(), w.metadata),
+	})
 	if err != nil {
 		return err
 	}
+	commitOffset := len(buf)
 	buf = append(buf, commitLine...)
 
 	// Write buffer to file
@@ -187,27 +456,33 @@ func (f *File) ReadWrite(do func(r *Reader, w *Writer) error) error {
 	}
 
 	// Ensure file changes are persisted to disk
-	err = f.w.Sync()
+	err = syncFile(f.w)
 	if err != nil {
+		f.mustTruncateTailCorruption(startOffset) // the transaction is reported as failed, so it must not be replayed
 		return fmt.Errorf("sync: %w", err)
 	}
 
 	// Update memstate
+	txLines := make([]txReplayLine, len(w.lines))
 	for i, l := range w.lines {
-		gmidx := f.memidxs[l.GroupID] // nil check is performed during the buffer encoding
-		switch l.Op {
-		default:
-			panic("unreachable")
-		case OpPut:
-			gmidx.put(l.Key, l.At, positions[i])
-		case OpDelete:
-			gmidx.delete(l.Key)
+		txLines[i] = txReplayLine{p: NewPosition(startOffset+positions[i].Offset(), positions[i].Length()), l: l}
+	}
+	commit := NewPosition(startOffset+int64(commitOffset), int64(len(commitLine)))
+	err = f.applyTx(txLines, commit) // group IDs are checked during the buffer encoding and values are not compressed
+	if err != nil {
+		panic(fmt.Errorf("unreachable: %w", err))
+	}
+	for _, txLine := range txLines {
+		if txLine.l.Op == OpPut {
+			f.cache.add(txLine.p, txLine.l.Value)
 		}
 	}
-
+	f.lastTxID = txID
+	f.notifyCommit()
 	return nil
 }
 
+// In returns the group with the given ID, or nil if it wasn't declared when opening the file (see Group).
 func (w *Writer) In(gid GroupID) *GroupWriter {
 	gmemidx := w.f.memidxs[gid]
 	if gmemidx == nil {
@@ -216,6 +491,15 @@ func (w *Writer) In(gid GroupID) *GroupWriter {
 	return &GroupWriter{w: w, gid: gid, midx: gmemidx}
 }
 
+// Group is like In, but returns ErrGroupNotFound if the group wasn't declared when opening the file.
+func (w *Writer) Group(gid GroupID) (*GroupWriter, error) {
+	g := w.In(gid)
+	if g == nil {
+		return nil, fmt.Errorf("%w: %d", ErrGroupNotFound, gid)
+	}
+	return g, nil
+}
+
 type GroupWriter struct {
 	w    *Writer
 	gid  GroupID
@@ -230,11 +514,56 @@ func (g *GroupWriter) Delete(key []byte) {
 	g.w.lines = append(g.w.lines, Line{Op: OpDelete, At: time.Now(), GroupID: g.gid, Key: key})
 }
 
+// DeleteRange deletes the keys from start (inclusive) to end (exclusive) in lexicographical order.
+// If end is empty, all keys from start are deleted. The deletion is written as a single line.
+func (g *GroupWriter) DeleteRange(start, end []byte) {
+	g.w.lines = append(g.w.lines, Line{Op: OpDeleteRange, At: time.Now(), GroupID: g.gid, Key: start, Value: end})
+}
+
+// DeletePrefix deletes the keys starting with the given prefix. The deletion is written as a single line.
+func (g *GroupWriter) DeletePrefix(prefix []byte) {
+	g.w.lines = append(g.w.lines, Line{Op: OpDeletePrefix, At: time.Now(), GroupID: g.gid, Key: prefix})
+}
+
+// Clear deletes all keys of the group. The deletion is written as a single line.
+func (g *GroupWriter) Clear() {
+	g.w.lines = append(g.w.lines, Line{Op: OpClear, At: time.Now(), GroupID: g.gid})
+}
+
+// syncFile persists file changes to disk (replaced in tests to simulate failures).
+var syncFile = (*os.File).Sync
+
 func (f *File) mustTruncateTailCorruption(truncateAt int64) {
 	err := f.w.Truncate(truncateAt)
 	if err != nil {
 		panic(fmt.Errorf("file tail corruption at offset %d: %w", truncateAt, err))
 	}
 	f.fsize = truncateAt
-	f.initMemstate()
+}
+
+// lockCtx acquires a lock unless the context is done first.
+// If the context wins, the lock is released as soon as it is acquired.
+func lockCtx(ctx context.Context, lock, unlock func()) error {
+	if ctx.Done() == nil {
+		lock() // never canceled
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	locked := make(chan struct{})
+	go func() {
+		lock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			unlock()
+		}()
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,188 @@
+package jiffy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testGroups = map[GroupID]int{'k': 16}
+
+func TestCommitSyncFailure(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "db")
+	f := openTestFile(t, fpath)
+	putTestValues(t, f, "a", "1")
+	size := f.fsize
+
+	errSync := errors.New("sync failed")
+	syncFile = func(*os.File) error { return errSync }
+	err := f.ReadWrite(func(r *Reader, w *Writer) error {
+		w.In('k').Put([]byte("b"), []byte("2"))
+		return nil
+	})
+	syncFile = (*os.File).Sync
+	if !errors.Is(err, errSync) {
+		t.Fatalf("got %v, want %v", err, errSync)
+	}
+	if f.fsize != size {
+		t.Fatalf("got file size %d after failed sync, want %d", f.fsize, size)
+	}
+
+	// The next transaction reuses the ID of the failed one, the file must still be replayable
+	putTestValues(t, f, "c", "3")
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f = openTestFile(t, fpath)
+	assertTestValues(t, f, map[string]string{"a": "1", "c": "3"})
+}
+
+func TestRollbackTo(t *testing.T) {
+	f := openTestFile(t, filepath.Join(t.TempDir(), "db"))
+	var otherSp Savepoint
+	err := f.ReadWrite(func(r *Reader, w *Writer) error {
+		otherSp = w.Savepoint()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.ReadWrite(func(r *Reader, w *Writer) error {
+		w.Annotate("author", "test")
+		w.In('k').Put([]byte("a"), []byte("1"))
+		sp1 := w.Savepoint()
+		w.In('k').Put([]byte("b"), []byte("2"))
+		sp2 := w.Savepoint()
+		w.In('k').Put([]byte("c"), []byte("3"))
+		err := w.RollbackTo(sp1)
+		if err != nil {
+			return err
+		}
+		err = w.RollbackTo(sp2)
+		if !errors.Is(err, ErrInvalidSavepoint) {
+			t.Fatalf("rollback to a released savepoint: got %v, want %v", err, ErrInvalidSavepoint)
+		}
+		err = w.RollbackTo(otherSp)
+		if !errors.Is(err, ErrInvalidSavepoint) {
+			t.Fatalf("rollback to another transaction's savepoint: got %v, want %v", err, ErrInvalidSavepoint)
+		}
+		w.In('k').Put([]byte("d"), []byte("4"))
+		return w.RollbackTo(sp1) // savepoints can be rolled back to several times
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTestValues(t, f, map[string]string{"a": "1"})
+
+	// Metadata is kept
+	err = f.Read(func(r *Reader) error {
+		tx, err := r.In('k').Seek([]byte("a")).History().Version(0).Tx()
+		if err != nil {
+			return err
+		}
+		if tx.Lines != 1 || tx.Metadata["author"] != "test" {
+			t.Fatalf("got %d lines and metadata %q, want 1 line and the author", tx.Lines, tx.Metadata)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBulkDeletions(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "db")
+	f := openTestFile(t, fpath)
+	putTestValues(t, f, "a", "1", "b1", "1", "b2", "1", "c", "1", "d1", "1", "d2", "1", "e", "1")
+	err := f.ReadWrite(func(r *Reader, w *Writer) error {
+		w.In('k').DeleteRange([]byte("b1"), []byte("c")) // end is exclusive
+		w.In('k').DeletePrefix([]byte("d"))
+		w.In('k').DeleteRange([]byte("e"), nil) // unbounded
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "1", "c": "1"}
+	assertTestValues(t, f, want)
+	f = reopenTestFile(t, f)
+	assertTestValues(t, f, want)
+
+	// Lines following a clear in the same transaction are kept
+	err = f.ReadWrite(func(r *Reader, w *Writer) error {
+		w.In('k').Clear()
+		w.In('k').Put([]byte("f"), []byte("2"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"f": "2"}
+	assertTestValues(t, f, want)
+	f = reopenTestFile(t, f)
+	assertTestValues(t, f, want)
+}
+
+func openTestFile(t *testing.T, fpath string, opts ...Option) *File {
+	t.Helper()
+	f, err := Open(fpath, nil, testGroups, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+// reopenTestFile closes the file and opens it again.
+func reopenTestFile(t *testing.T, f *File, opts ...Option) *File {
+	t.Helper()
+	err := f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return openTestFile(t, f.fpath, opts...)
+}
+
+// putTestValues puts the given key-value pairs in a single transaction.
+func putTestValues(t *testing.T, f *File, kvs ...string) {
+	t.Helper()
+	err := f.ReadWrite(func(r *Reader, w *Writer) error {
+		for i := 0; i < len(kvs); i += 2 {
+			w.In('k').Put([]byte(kvs[i]), []byte(kvs[i+1]))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertTestValues checks that the file contains exactly the given key-value pairs.
+func assertTestValues(t *testing.T, f *File, want map[string]string) {
+	t.Helper()
+	got := map[string]string{}
+	err := f.Read(func(r *Reader) error {
+		for c := r.In('k').Oldest(); c != nil; c = c.Next() {
+			value, err := c.History().Value()
+			if err != nil {
+				return err
+			}
+			got[string(c.Key())] = string(value)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
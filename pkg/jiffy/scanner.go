@@ -0,0 +1,58 @@
+package jiffy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// lineScanner reads the lines of a linefile sequentially without restoring its memstate.
+type lineScanner struct {
+	fd           *os.File
+	r            *bufio.Reader
+	ffmt         FileFormat
+	headerLength int64
+	offset       int64 // offset of the next line
+}
+
+// openLineScanner opens a linefile for reading.
+// Like read-only opens, it doesn't take the file lock, so the file can be read while a writer has it open.
+// If ffmt is nil, the file format is detected from the file header.
+func openLineScanner(fpath string, ffmt FileFormat) (*lineScanner, error) {
+	fd, err := os.Open(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", fpath, err)
+	}
+	s := &lineScanner{fd: fd, r: bufio.NewReader(fd)}
+	_, descriptor, headerLength, err := readHeader(s.r)
+	if err != nil {
+		fd.Close()
+		return nil, fmt.Errorf("%q: %w", fpath, err)
+	}
+	s.ffmt, err = resolveFileFormat(ffmt, descriptor)
+	if err != nil {
+		fd.Close()
+		return nil, fmt.Errorf("%q: %w", fpath, err)
+	}
+	s.headerLength, s.offset = headerLength, headerLength
+	return s, nil
+}
+
+// next decodes the next line and returns its position.
+// It returns io.EOF at the end of the file, including when the last line is incomplete.
+func (s *lineScanner) next() (Position, Line, error) {
+	lineStart := s.offset
+	lineLength, l, err := s.ffmt.Decode(s.r)
+	s.offset += lineLength
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return NewPosition(lineStart, lineLength), l, io.EOF
+	}
+	if err != nil {
+		return NewPosition(lineStart, lineLength), l, fmt.Errorf("read row at offset %d: %w", lineStart, err)
+	}
+	return NewPosition(lineStart, lineLength), l, nil
+}
+
+func (s *lineScanner) Close() error { return s.fd.Close() }
@@ -0,0 +1,200 @@
+package jiffy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transactions are written as an envelope:
+//
+//   - a begin line (OpBegin) whose key is the transaction ID,
+//   - the transaction's put and delete lines,
+//   - a commit line (OpCommit) whose key is the transaction ID and whose value holds
+//     the number of lines, their checksum and the transaction metadata
+//     (as a URL-encoded query, ex: "crc32=1a2b3c4d&lines=2&meta.author=billing").
+//
+// Transaction IDs are decimal and monotonically increasing.
+// Files written before envelopes were introduced have commit lines without key and value,
+// their transactions are replayed without verification.
+
+var ErrCorruptTx = errors.New("corrupt transaction")
+
+const (
+	commitFieldLines     = "lines"
+	commitFieldCRC32     = "crc32"
+	commitMetadataPrefix = "meta."
+)
+
+func encodeTxID(id uint64) []byte { return strconv.AppendUint(nil, id, 10) }
+
+func parseTxID(key []byte) (uint64, error) {
+	id, err := strconv.ParseUint(string(key), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse transaction ID: %w", err)
+	}
+	return id, nil
+}
+
+// txSummary holds the information stored in a commit line to verify the transaction's completeness.
+type txSummary struct {
+	lines int
+	crc32 uint32
+}
+
+// encodeCommitValue encodes the transaction summary and metadata stored in the commit line.
+// Metadata keys are prefixed to avoid collisions with the summary fields.
+func encodeCommitValue(s txSummary, metadata map[string]string) []byte {
+	v := url.Values{}
+	v.Set(commitFieldLines, strconv.Itoa(s.lines))
+	v.Set(commitFieldCRC32, fmt.Sprintf("%08x", s.crc32))
+	for key, value := range metadata {
+		v.Set(commitMetadataPrefix+key, value)
+	}
+	return []byte(v.Encode())
+}
+
+func parseCommitValue(value []byte) (txSummary, map[string]string, error) {
+	s := txSummary{}
+	v, err := url.ParseQuery(string(value))
+	if err != nil {
+		return s, nil, fmt.Errorf("parse commit value: %w", err)
+	}
+	s.lines, err = strconv.Atoi(v.Get(commitFieldLines))
+	if err != nil {
+		return s, nil, fmt.Errorf("parse number of lines: %w", err)
+	}
+	crc, err := strconv.ParseUint(v.Get(commitFieldCRC32), 16, 32)
+	if err != nil {
+		return s, nil, fmt.Errorf("parse checksum: %w", err)
+	}
+	s.crc32 = uint32(crc)
+	var metadata map[string]string
+	for key := range v {
+		if metadataKey, ok := strings.CutPrefix(key, commitMetadataPrefix); ok {
+			if metadata == nil {
+				metadata = map[string]string{}
+			}
+			metadata[metadataKey] = v.Get(key)
+		}
+	}
+	return s, metadata, nil
+}
+
+// TxInfo holds the information stored in a transaction's commit line.
+type TxInfo struct {
+	ID       uint64            // zero for transactions written before transaction IDs were introduced
+	At       time.Time         // commit timestamp
+	Lines    int               // number of put and delete lines
+	Metadata map[string]string // annotations (see Writer.Annotate)
+}
+
+// parseTxInfo parses a commit line.
+func parseTxInfo(l Line) (*TxInfo, error) {
+	tx := &TxInfo{At: l.At}
+	if len(l.Key) == 0 {
+		return tx, nil // written without envelope
+	}
+	var err error
+	tx.ID, err = parseTxID(l.Key)
+	if err != nil {
+		return nil, err
+	}
+	s, metadata, err := parseCommitValue(l.Value)
+	if err != nil {
+		return nil, err
+	}
+	tx.Lines, tx.Metadata = s.lines, metadata
+	return tx, nil
+}
+
+// txChecksum computes the checksum of a transaction's lines.
+// It doesn't depend on the file format, so it remains valid after converting a file.
+type txChecksum struct {
+	h     hash.Hash32
+	lines int
+}
+
+func newTxChecksum() *txChecksum { return &txChecksum{h: crc32.NewIEEE()} }
+
+func (c *txChecksum) add(l Line) {
+	buf := make([]byte, 0, 2+2*binary.MaxVarintLen64+len(l.Key)+len(l.Value))
+	buf = append(buf, byte(l.Op), byte(l.GroupID))
+	buf = binary.AppendUvarint(buf, uint64(len(l.Key)))
+	buf = append(buf, l.Key...)
+	buf = binary.AppendUvarint(buf, uint64(len(l.Value)))
+	buf = append(buf, l.Value...)
+	_, _ = c.h.Write(buf) // never returns an error
+	c.lines++
+}
+
+func (c *txChecksum) summary() txSummary { return txSummary{lines: c.lines, crc32: c.h.Sum32()} }
+
+// txVerifier checks the envelope of transactions while replaying a file.
+type txVerifier struct {
+	begun    bool
+	id       uint64
+	lastID   uint64 // ID of the last verified transaction, IDs must increase
+	checksum *txChecksum
+}
+
+// begin starts a new transaction envelope.
+func (v *txVerifier) begin(l Line, pending int) error {
+	if v.begun || pending > 0 {
+		return fmt.Errorf("%w: begin line inside a transaction", ErrCorruptTx)
+	}
+	id, err := parseTxID(l.Key)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCorruptTx, err)
+	}
+	if id <= v.lastID {
+		return fmt.Errorf("%w: transaction %d follows transaction %d", ErrCorruptTx, id, v.lastID)
+	}
+	v.begun, v.id, v.checksum = true, id, newTxChecksum()
+	return nil
+}
+
+// add adds a transaction line to the checksum.
+func (v *txVerifier) add(l Line) {
+	if v.begun {
+		v.checksum.add(l)
+	}
+}
+
+// commit verifies the commit line against the transaction's lines and returns the transaction ID
+// (zero for transactions written without envelope).
+func (v *txVerifier) commit(l Line) (uint64, error) {
+	defer func() { v.begun, v.checksum = false, nil }()
+	if len(l.Key) == 0 {
+		if v.begun {
+			return 0, fmt.Errorf("%w: commit line without transaction ID", ErrCorruptTx)
+		}
+		return 0, nil // written without envelope
+	}
+	id, err := parseTxID(l.Key)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrCorruptTx, err)
+	}
+	if !v.begun {
+		return 0, fmt.Errorf("%w: commit line for transaction %d without begin line", ErrCorruptTx, id)
+	}
+	if id != v.id {
+		return 0, fmt.Errorf("%w: commit line for transaction %d in transaction %d", ErrCorruptTx, id, v.id)
+	}
+	expected, _, err := parseCommitValue(l.Value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrCorruptTx, err)
+	}
+	if got := v.checksum.summary(); got != expected {
+		return 0, fmt.Errorf("%w: transaction %d has %d lines (checksum %08x), expected %d lines (checksum %08x)",
+			ErrCorruptTx, id, got.lines, got.crc32, expected.lines, expected.crc32)
+	}
+	v.lastID = id
+	return id, nil
+}
@@ -0,0 +1,119 @@
+package jiffy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplayCorruptTx(t *testing.T) {
+	badChecksum := envelopeTestLines(1, "a", "1")
+	badChecksum[2].Value = encodeCommitValue(txSummary{lines: 1}, nil)
+	missingBegin := envelopeTestLines(1, "a", "1")[1:]
+	for _, tt := range []struct {
+		name  string
+		lines []Line
+	}{
+		{"checksum mismatch", badChecksum},
+		{"missing begin line", missingBegin},
+		{"duplicate ID", append(envelopeTestLines(1, "a", "1"), envelopeTestLines(1, "b", "2")...)},
+		{"decreasing ID", append(envelopeTestLines(2, "a", "1"), envelopeTestLines(1, "b", "2")...)},
+		{"nested begin line", append(envelopeTestLines(1, "a", "1")[:2], envelopeTestLines(2, "b", "2")...)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fpath := writeEnvelopeTestFile(t, tt.lines...)
+			_, err := Open(fpath, nil, testGroups)
+			if !errors.Is(err, ErrCorruptTx) {
+				t.Fatalf("got %v, want %v", err, ErrCorruptTx)
+			}
+		})
+	}
+}
+
+func TestReplayInterruptedTx(t *testing.T) {
+	committed := envelopeTestLines(1, "a", "1")
+	interrupted := envelopeTestLines(2, "b", "2")[:2] // no commit line
+	fpath := writeEnvelopeTestFile(t, append(committed, interrupted...)...)
+
+	f := openTestFile(t, fpath)
+	assertTestValues(t, f, map[string]string{"a": "1"})
+	stat, err := os.Stat(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() != f.fsize {
+		t.Fatalf("got file size %d, want the interrupted transaction truncated at %d", stat.Size(), f.fsize)
+	}
+
+	// The ID of the interrupted transaction is reused
+	putTestValues(t, f, "c", "3")
+	assertLastTxID(t, f, 2)
+}
+
+func TestReplayLegacyCommits(t *testing.T) {
+	fpath := writeEnvelopeTestFile(t,
+		Line{Op: OpPut, At: time.Now(), GroupID: 'k', Key: []byte("a"), Value: []byte("1")},
+		Line{Op: OpCommit, At: time.Now(), GroupID: GroupID(OpCommit)}, // without ID, lines and checksum
+	)
+	f := openTestFile(t, fpath)
+	assertTestValues(t, f, map[string]string{"a": "1"})
+	assertLastTxID(t, f, 0)
+	putTestValues(t, f, "b", "2")
+	assertLastTxID(t, f, 1)
+	err := f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f = openTestFile(t, fpath)
+	assertTestValues(t, f, map[string]string{"a": "1", "b": "2"})
+	assertLastTxID(t, f, 1)
+}
+
+// envelopeTestLines returns the lines of a transaction putting the given key-value pairs in group 'k'.
+func envelopeTestLines(id uint64, kvs ...string) []Line {
+	at := time.Now()
+	lines := []Line{{Op: OpBegin, At: at, GroupID: GroupID(OpBegin), Key: encodeTxID(id)}}
+	checksum := newTxChecksum()
+	for i := 0; i < len(kvs); i += 2 {
+		l := Line{Op: OpPut, At: at, GroupID: 'k', Key: []byte(kvs[i]), Value: []byte(kvs[i+1])}
+		checksum.add(l)
+		lines = append(lines, l)
+	}
+	return append(lines, Line{
+		Op:      OpCommit,
+		At:      at,
+		GroupID: GroupID(OpCommit),
+		Key:     encodeTxID(id),
+		Value:   encodeCommitValue(checksum.summary(), nil),
+	})
+}
+
+// writeEnvelopeTestFile writes a file with the escaped text format containing the given lines.
+func writeEnvelopeTestFile(t *testing.T, lines ...Line) string {
+	t.Helper()
+	fpath := filepath.Join(t.TempDir(), "db")
+	err := os.WriteFile(fpath, encodeHeader(DefaultEscapedTextFileFormat), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendTestLines(t, fpath, DefaultEscapedTextFileFormat, lines...)
+	return fpath
+}
+
+func assertLastTxID(t *testing.T, f *File, want uint64) {
+	t.Helper()
+	var got uint64
+	err := f.Read(func(r *Reader) error {
+		got = r.LastTxID()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("got last transaction ID %d, want %d", got, want)
+	}
+}
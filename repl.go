@@ -30,6 +30,10 @@ func handleCommand(f *jiffy.File, line string) {
 				}
 				args = parts[1:]
 			}
+			if cmd.outsideTx && tx != nil {
+				fmt.Printf("%q is not available inside a transaction, commit or rollback first\n", keyword)
+				return
+			}
 			cmd.do(f, args...)
 			return
 		}
@@ -47,10 +51,31 @@ func printAvailableCommands(commands []*command) {
 }
 
 type command struct {
-	desc     string
-	keywords []string
-	args     []string
-	do       func(f *jiffy.File, args ...string)
+	desc      string
+	keywords  []string
+	args      []string
+	outsideTx bool // the command waits for the file lock, so it would block while a transaction is open
+	do        func(f *jiffy.File, args ...string)
+}
+
+// tx is the transaction opened with the "begin" command, if any.
+// Commands run inside of it until "commit" or "rollback".
+var tx *jiffy.Tx
+
+// read runs a read-only transaction, or reuses the open transaction.
+func read(f *jiffy.File, do func(r *jiffy.Reader) error) error {
+	if tx != nil {
+		return do(tx.Reader())
+	}
+	return f.Read(do)
+}
+
+// readWrite runs a read-write transaction, or adds to the open transaction.
+func readWrite(f *jiffy.File, do func(r *jiffy.Reader, w *jiffy.Writer) error) error {
+	if tx != nil {
+		return do(tx.Reader(), tx.Writer())
+	}
+	return f.ReadWrite(do)
 }
 
 var commands = []*command{
@@ -67,14 +92,98 @@ var commands = []*command{
 	// 		fmt.Printf("compacted in %s\n", time.Since(start))
 	// 	},
 	// },
+	{
+		keywords:  []string{"begin"},
+		desc:      "start a transaction, the following commands are committed together",
+		outsideTx: true,
+		do: func(f *jiffy.File, args ...string) {
+			var err error
+			tx, err = f.Begin()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			tx.Writer().Annotate("source", "repl")
+			fmt.Println("transaction started")
+		},
+	},
+	{
+		keywords: []string{"commit"},
+		desc:     "commit the current transaction",
+		do: func(f *jiffy.File, args ...string) {
+			if tx == nil {
+				fmt.Println("no transaction in progress")
+				return
+			}
+			err := tx.Commit()
+			tx = nil
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println("transaction committed")
+		},
+	},
+	{
+		keywords: []string{"rollback"},
+		desc:     "discard the current transaction",
+		do: func(f *jiffy.File, args ...string) {
+			if tx == nil {
+				fmt.Println("no transaction in progress")
+				return
+			}
+			err := tx.Rollback()
+			tx = nil
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println("transaction rolled back")
+		},
+	},
+	{
+		keywords:  []string{"backup"},
+		desc:      "write a consistent copy of the database to the given path",
+		outsideTx: true,
+		args:      []string{"path"},
+		do: func(f *jiffy.File, args ...string) {
+			start := time.Now()
+			offset, err := f.BackupTo(args[0])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("backed up %d bytes to %q in %s\n", offset, args[0], time.Since(start))
+		},
+	},
+	{
+		keywords:  []string{"incremental-backup", "backup+"},
+		desc:      "append changes since the previous backup at the given path",
+		outsideTx: true,
+		args:      []string{"path"},
+		do: func(f *jiffy.File, args ...string) {
+			start := time.Now()
+			offset, err := f.IncrementalBackupTo(args[0])
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("backup at %q is up to date (%d bytes) in %s\n", args[0], offset, time.Since(start))
+		},
+	},
 	{
 		keywords: []string{"set", "+"},
 		desc:     "set a key-value pair in the database",
 		args:     []string{"group ID", "key", "value"},
 		do: func(f *jiffy.File, args ...string) {
 			gid, key, value := jiffy.GroupID(args[0][0]), []byte(args[1]), []byte(args[2])
-			err := f.ReadWrite(func(r *jiffy.Reader, w *jiffy.Writer) error {
-				w.In(gid).Put(key, value)
+			err := readWrite(f, func(r *jiffy.Reader, w *jiffy.Writer) error {
+				w.Annotate("source", "repl")
+				g, err := w.Group(gid)
+				if err != nil {
+					return err
+				}
+				g.Put(key, value)
 				return nil
 			})
 			if err != nil {
@@ -90,8 +199,13 @@ var commands = []*command{
 		args:     []string{"group ID", "key"},
 		do: func(f *jiffy.File, args ...string) {
 			gid, key := jiffy.GroupID(args[0][0]), []byte(args[1])
-			err := f.ReadWrite(func(r *jiffy.Reader, w *jiffy.Writer) error {
-				w.In(gid).Delete(key)
+			err := readWrite(f, func(r *jiffy.Reader, w *jiffy.Writer) error {
+				w.Annotate("source", "repl")
+				g, err := w.Group(gid)
+				if err != nil {
+					return err
+				}
+				g.Delete(key)
 				return nil
 			})
 			if err != nil {
@@ -101,26 +215,93 @@ var commands = []*command{
 			fmt.Printf("deleted %q\n", key)
 		},
 	},
+	{
+		keywords: []string{"delete-prefix"},
+		desc:     "delete all key-value pairs whose key starts with the given prefix",
+		args:     []string{"group ID", "prefix"},
+		do: func(f *jiffy.File, args ...string) {
+			gid, prefix := jiffy.GroupID(args[0][0]), []byte(args[1])
+			err := readWrite(f, func(r *jiffy.Reader, w *jiffy.Writer) error {
+				w.Annotate("source", "repl")
+				g, err := w.Group(gid)
+				if err != nil {
+					return err
+				}
+				g.DeletePrefix(prefix)
+				return nil
+			})
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("deleted keys starting with %q\n", prefix)
+		},
+	},
+	{
+		keywords: []string{"delete-range"},
+		desc:     "delete all key-value pairs from start (inclusive) to end (exclusive)",
+		args:     []string{"group ID", "start", "end"},
+		do: func(f *jiffy.File, args ...string) {
+			gid, start, end := jiffy.GroupID(args[0][0]), []byte(args[1]), []byte(args[2])
+			err := readWrite(f, func(r *jiffy.Reader, w *jiffy.Writer) error {
+				w.Annotate("source", "repl")
+				g, err := w.Group(gid)
+				if err != nil {
+					return err
+				}
+				g.DeleteRange(start, end)
+				return nil
+			})
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("deleted keys from %q to %q\n", start, end)
+		},
+	},
+	{
+		keywords: []string{"clear"},
+		desc:     "delete all key-value pairs of a group",
+		args:     []string{"group ID"},
+		do: func(f *jiffy.File, args ...string) {
+			gid := jiffy.GroupID(args[0][0])
+			err := readWrite(f, func(r *jiffy.Reader, w *jiffy.Writer) error {
+				w.Annotate("source", "repl")
+				g, err := w.Group(gid)
+				if err != nil {
+					return err
+				}
+				g.Clear()
+				return nil
+			})
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Printf("cleared group %q\n", gid)
+		},
+	},
 	{
 		keywords: []string{"get"},
 		desc:     "get the value associated with a given key",
 		args:     []string{"group ID", "key"},
 		do: func(f *jiffy.File, args ...string) {
 			gid, key := jiffy.GroupID(args[0][0]), []byte(args[1])
-			_ = f.Read(func(r *jiffy.Reader) error {
-				c := r.In(gid).Seek(key)
-				if c == nil {
-					fmt.Printf("%q not found\n", key)
-					return nil
+			err := read(f, func(r *jiffy.Reader) error {
+				g, err := r.Group(gid)
+				if err != nil {
+					return err
 				}
-				value, err := c.History().Value()
+				value, err := g.Get(key)
 				if err != nil {
-					fmt.Println(err)
-					return nil
+					return err
 				}
 				fmt.Printf("%q = %q\n", key, value)
 				return nil
 			})
+			if err != nil {
+				fmt.Println(err)
+			}
 		},
 	},
 	{
@@ -129,10 +310,17 @@ var commands = []*command{
 		args:     []string{"group ID", "key"},
 		do: func(f *jiffy.File, args ...string) {
 			gid, key := jiffy.GroupID(args[0][0]), []byte(args[1])
-			_ = f.Read(func(r *jiffy.Reader) error {
-				fmt.Println(r.In(gid).Seek(key) != nil)
+			err := read(f, func(r *jiffy.Reader) error {
+				g, err := r.Group(gid)
+				if err != nil {
+					return err
+				}
+				fmt.Println(g.Seek(key) != nil)
 				return nil
 			})
+			if err != nil {
+				fmt.Println(err)
+			}
 		},
 	},
 	{
@@ -141,10 +329,17 @@ var commands = []*command{
 		args:     []string{"group ID"},
 		do: func(f *jiffy.File, args ...string) {
 			gid := jiffy.GroupID(args[0][0])
-			_ = f.Read(func(r *jiffy.Reader) error {
-				fmt.Println(r.In(gid).Count())
+			err := read(f, func(r *jiffy.Reader) error {
+				g, err := r.Group(gid)
+				if err != nil {
+					return err
+				}
+				fmt.Println(g.Count())
 				return nil
 			})
+			if err != nil {
+				fmt.Println(err)
+			}
 		},
 	},
 	{
@@ -153,12 +348,19 @@ var commands = []*command{
 		args:     []string{"group ID"},
 		do: func(f *jiffy.File, args ...string) {
 			gid := jiffy.GroupID(args[0][0])
-			_ = f.Read(func(r *jiffy.Reader) error {
-				for rr := r.In(gid).Oldest(); rr != nil; rr = rr.Next() {
+			err := read(f, func(r *jiffy.Reader) error {
+				g, err := r.Group(gid)
+				if err != nil {
+					return err
+				}
+				for rr := g.Oldest(); rr != nil; rr = rr.Next() {
 					fmt.Printf("%q\n", rr.Key())
 				}
 				return nil
 			})
+			if err != nil {
+				fmt.Println(err)
+			}
 		},
 	},
 	{
@@ -167,9 +369,13 @@ var commands = []*command{
 		args:     []string{"group ID"},
 		do: func(f *jiffy.File, args ...string) {
 			gid := jiffy.GroupID(args[0][0])
-			_ = f.Read(func(r *jiffy.Reader) error {
+			err := read(f, func(r *jiffy.Reader) error {
+				g, err := r.Group(gid)
+				if err != nil {
+					return err
+				}
 				i := 0
-				for c := r.In(gid).Latest(); c != nil; c = c.Previous() {
+				for c := g.Latest(); c != nil; c = c.Previous() {
 					if i >= 10 {
 						break
 					}
@@ -183,6 +389,9 @@ var commands = []*command{
 				}
 				return nil
 			})
+			if err != nil {
+				fmt.Println(err)
+			}
 		},
 	},
 	{
@@ -191,9 +400,13 @@ var commands = []*command{
 		args:     []string{"group ID"},
 		do: func(f *jiffy.File, args ...string) {
 			gid := jiffy.GroupID(args[0][0])
-			_ = f.Read(func(r *jiffy.Reader) error {
+			err := read(f, func(r *jiffy.Reader) error {
+				g, err := r.Group(gid)
+				if err != nil {
+					return err
+				}
 				i := 0
-				for c := r.In(gid).Oldest(); c != nil; c = c.Next() {
+				for c := g.Oldest(); c != nil; c = c.Next() {
 					if i >= 10 {
 						break
 					}
@@ -207,6 +420,33 @@ var commands = []*command{
 				}
 				return nil
 			})
+			if err != nil {
+				fmt.Println(err)
+			}
+		},
+	},
+	{
+		keywords: []string{"log"},
+		desc:     "show the last 10 transactions",
+		do: func(f *jiffy.File, args ...string) {
+			_ = read(f, func(r *jiffy.Reader) error {
+				var txs []*jiffy.TxInfo
+				err := r.Log(func(tx *jiffy.TxInfo) error {
+					txs = append(txs, tx)
+					if len(txs) > 10 {
+						txs = txs[1:]
+					}
+					return nil
+				})
+				if err != nil {
+					fmt.Println(err)
+					return nil
+				}
+				for _, tx := range txs {
+					fmt.Printf("#%d %s (%d lines) %v\n", tx.ID, tx.At.Format(time.RFC3339Nano), tx.Lines, tx.Metadata)
+				}
+				return nil
+			})
 		},
 	},
 	{
@@ -221,11 +461,15 @@ var commands = []*command{
 				fmt.Println(err)
 				return
 			}
-			err = f.ReadWrite(func(r *jiffy.Reader, w *jiffy.Writer) error {
+			err = readWrite(f, func(r *jiffy.Reader, w *jiffy.Writer) error {
+				g, err := w.Group(gid)
+				if err != nil {
+					return err
+				}
 				for i := 0; i < num; i++ {
 					key := []byte(strconv.Itoa(i))
 					value := []byte(time.Now().Format(time.RFC3339))
-					w.In(gid).Put(key, value)
+					g.Put(key, value)
 				}
 				return nil
 			})